@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/middleware"
 	"github.com/junaidrashid-git/ecommerce-api/models"
 	"gorm.io/gorm"
 )
@@ -36,7 +37,10 @@ func ApproveAdmin(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Model(&admin).Update("approved", true).Error; err != nil {
+		if err := db.Model(&admin).Updates(map[string]interface{}{
+			"approved":    true,
+			"approved_by": middleware.Actor(c),
+		}).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve admin"})
 			return
 		}
@@ -0,0 +1,27 @@
+package adminController
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// GetAdminActions returns the admin audit log, newest first.
+// Optional filter: ?actor=admin@example.com
+func GetAdminActions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Model(&models.AdminAction{})
+		if actor := c.Query("actor"); actor != "" {
+			query = query.Where("actor = ?", actor)
+		}
+
+		var actions []models.AdminAction
+		if err := query.Order("created_at DESC").Limit(500).Find(&actions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch admin actions"})
+			return
+		}
+		c.JSON(http.StatusOK, actions)
+	}
+}
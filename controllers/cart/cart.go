@@ -1,10 +1,13 @@
 package cartControllers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	orderControllers "github.com/junaidrashid-git/ecommerce-api/controllers/order"
 	"github.com/junaidrashid-git/ecommerce-api/models"
 	"gorm.io/gorm"
 )
@@ -43,6 +46,13 @@ func UpdateCartItem(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Snapshot the price customers pay now, including any running sale
+		price, _, err := models.EffectivePrice(db, product)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price product"})
+			return
+		}
+
 		// Check if user has a cart
 		var cart models.Cart
 		if err := db.Where("user_id = ?", userID).First(&cart).Error; err != nil {
@@ -50,9 +60,13 @@ func UpdateCartItem(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if rejectWhilePaying(c, db, cart.CartID) {
+			return
+		}
+
 		// Check if item already exists in the cart
 		var item models.CartItem
-		err := db.Where("cart_id = ? AND product_id = ?", cart.CartID, input.ProductID).First(&item).Error
+		err = db.Where("cart_id = ? AND product_id = ?", cart.CartID, input.ProductID).First(&item).Error
 		if err != nil {
 			// New cart item
 			if err == gorm.ErrRecordNotFound {
@@ -63,7 +77,7 @@ func UpdateCartItem(db *gorm.DB) gin.HandlerFunc {
 					ProductArName:       product.ARName,
 					ProductImage:        product.Image,
 					ProductStock:        product.Stock,
-					ProductSalePrice:    product.SalePrice,
+					ProductSalePrice:    price,
 					ProductRegularPrice: product.RegularPrice,
 					Weight:              product.Weight,
 					Quantity:            input.Quantity,
@@ -111,6 +125,10 @@ func DeleteCartItem(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if rejectWhilePaying(c, db, cart.CartID) {
+			return
+		}
+
 		// Attempt to delete the cart item
 		result := db.Where("cart_id = ? AND product_id = ?", cart.CartID, productID).Delete(&models.CartItem{})
 		if result.Error != nil {
@@ -144,6 +162,10 @@ func ClearUserCart(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if rejectWhilePaying(c, db, cart.CartID) {
+			return
+		}
+
 		if err := db.Where("cart_id = ?", cart.CartID).Delete(&models.CartItem{}).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
 			return
@@ -152,7 +174,7 @@ func ClearUserCart(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// GET /user/cart
+// GET /user/cart?changes=true
 func GetUserCart(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userIDVal, exists := c.Get("user_id")
@@ -162,17 +184,35 @@ func GetUserCart(db *gorm.DB) gin.HandlerFunc {
 		}
 		userID := userIDVal.(string)
 
+		// Opt in to {items, changes}; existing clients get the bare items array
+		withChanges, err := strconv.ParseBool(c.DefaultQuery("changes", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid changes"})
+			return
+		}
+
 		var cart models.Cart
-		if err := db.Preload("Items").Where("user_id = ?", userID).First(&cart).Error; err != nil {
+		if err := db.Where("user_id = ?", userID).First(&cart).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
 			return
 		}
 
-		c.JSON(http.StatusOK, cart.Items)
+		// Revalidate against live products and report what changed
+		items, changes, err := orderControllers.RefreshCart(db, cart.CartID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh cart"})
+			return
+		}
+
+		if withChanges {
+			c.JSON(http.StatusOK, gin.H{"items": items, "changes": changes})
+			return
+		}
+		c.JSON(http.StatusOK, items)
 	}
 }
 
-// GET /user/cart
+// GET /admin/user-cart/:user_id
 func GetAdminUserCart(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.Param("user_id")
@@ -191,3 +231,142 @@ func GetAdminUserCart(db *gorm.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, cart.Items)
 	}
 }
+
+// GET /user/cart/summary
+// Prices the cart from live products with the same shipping rules as checkout,
+// flagging lines whose price or stock changed since they were added.
+func GetUserCartSummary(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDVal, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		userID := userIDVal.(string)
+
+		var cart models.Cart
+		if err := db.Where("user_id = ?", userID).First(&cart).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+			return
+		}
+
+		items, changes, err := orderControllers.RefreshCart(db, cart.CartID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh cart"})
+			return
+		}
+
+		dest, err := orderControllers.UserShippingAddress(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping address"})
+			return
+		}
+
+		cart.Items = items
+		summary, err := orderControllers.SummarizeCart(db, cart, dest)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price cart"})
+			return
+		}
+		summary.MarkChanges(changes)
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+type ApplyCouponInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// POST /user/cart/coupon
+// Applies a coupon to the cart if it gives a discount on the current items.
+func ApplyCartCoupon(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDVal, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		userID := userIDVal.(string)
+
+		var input ApplyCouponInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+			return
+		}
+
+		var cart models.Cart
+		if err := db.Preload("Items").Where("user_id = ?", userID).First(&cart).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User cart not found"})
+			return
+		}
+
+		if rejectWhilePaying(c, db, cart.CartID) {
+			return
+		}
+
+		dest, err := orderControllers.UserShippingAddress(db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping address"})
+			return
+		}
+
+		cart.CouponCode = orderControllers.NormalizeCouponCode(input.Code)
+		summary, err := orderControllers.SummarizeCart(db, cart, dest)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price cart"})
+			return
+		}
+		if summary.CouponError != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": summary.CouponError})
+			return
+		}
+
+		if err := db.Model(&cart).Update("coupon_code", cart.CouponCode).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply coupon"})
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// DELETE /user/cart/coupon
+func RemoveCartCoupon(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDVal, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		userID := userIDVal.(string)
+
+		var cart models.Cart
+		if err := db.Where("user_id = ?", userID).First(&cart).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User cart not found"})
+			return
+		}
+		if rejectWhilePaying(c, db, cart.CartID) {
+			return
+		}
+
+		if err := db.Model(&cart).Update("coupon_code", "").Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove coupon"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Coupon removed"})
+	}
+}
+
+// rejectWhilePaying answers 409 while the cart's card payment is in flight, so the
+// cart keeps matching what the customer is paying for. It reports whether it did.
+func rejectWhilePaying(c *gin.Context, db *gorm.DB, cartID uint) bool {
+	err := orderControllers.CheckCartEditable(db, cartID)
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, orderControllers.ErrCheckoutInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check cart payment"})
+	}
+	return true
+}
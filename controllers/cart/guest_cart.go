@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	orderControllers "github.com/junaidrashid-git/ecommerce-api/controllers/order"
 	"github.com/junaidrashid-git/ecommerce-api/models"
 	"gorm.io/gorm"
 )
@@ -38,6 +39,13 @@ func UpdateGuestCartItem(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Snapshot the price customers pay now, including any running sale
+		price, _, err := models.EffectivePrice(db, product)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price product"})
+			return
+		}
+
 		// Check if guest has a cart
 		var cart models.GuestCart
 		if err := db.Where("guest_id = ?", guestID).First(&cart).Error; err != nil {
@@ -55,7 +63,7 @@ func UpdateGuestCartItem(db *gorm.DB) gin.HandlerFunc {
 
 		// Check if item already exists
 		var item models.GuestCartItem
-		err := db.Where("cart_id = ? AND product_id = ?", cart.CartID, input.ProductID).First(&item).Error
+		err = db.Where("cart_id = ? AND product_id = ?", cart.CartID, input.ProductID).First(&item).Error
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
 				newItem := models.GuestCartItem{
@@ -65,7 +73,7 @@ func UpdateGuestCartItem(db *gorm.DB) gin.HandlerFunc {
 					ProductArName:       product.ARName,
 					ProductImage:        product.Image,
 					ProductStock:        product.Stock,
-					ProductSalePrice:    product.SalePrice,
+					ProductSalePrice:    price,
 					ProductRegularPrice: product.RegularPrice,
 					Weight:              product.Weight,
 					Quantity:            input.Quantity,
@@ -158,7 +166,7 @@ func ClearGuestCart(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// GET /guest/cart
+// GET /guest/cart?changes=true
 func GetGuestCart(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		guestID := c.Query("guest_id")
@@ -167,9 +175,20 @@ func GetGuestCart(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Opt in to {items, changes}; existing clients get the bare items array
+		withChanges, err := strconv.ParseBool(c.DefaultQuery("changes", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid changes"})
+			return
+		}
+
 		var cart models.GuestCart
-		if err := db.Preload("Items").Where("guest_id = ?", guestID).First(&cart).Error; err != nil {
+		if err := db.Where("guest_id = ?", guestID).First(&cart).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
+				if withChanges {
+					c.JSON(http.StatusOK, gin.H{"items": []models.GuestCartItem{}, "changes": []orderControllers.CartChange{}})
+					return
+				}
 				c.JSON(http.StatusOK, []models.GuestCartItem{})
 				return
 			}
@@ -177,6 +196,17 @@ func GetGuestCart(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusOK, cart.Items)
+		// Revalidate against live products and report what changed
+		items, changes, err := orderControllers.RefreshGuestCart(db, cart.CartID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh guest cart"})
+			return
+		}
+
+		if withChanges {
+			c.JSON(http.StatusOK, gin.H{"items": items, "changes": changes})
+			return
+		}
+		c.JSON(http.StatusOK, items)
 	}
 }
@@ -0,0 +1,217 @@
+package orderControllers
+
+import (
+	"errors"
+
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+type CartChangeType string
+
+const (
+	CartItemRemoved         CartChangeType = "removed"          // product was deleted
+	CartItemOutOfStock      CartChangeType = "out_of_stock"     // nothing left to sell, item removed
+	CartItemQuantityReduced CartChangeType = "quantity_reduced" // quantity clamped to available stock
+	CartItemPriceChanged    CartChangeType = "price_changed"
+)
+
+// CartChange tells the client how a cart item was adjusted when the cart was refreshed
+type CartChange struct {
+	ProductID    uint           `json:"product_id"`
+	ProductEName string         `json:"product_ename"`
+	Type         CartChangeType `json:"type"`
+	OldPrice     float64        `json:"old_price,omitempty"`
+	NewPrice     float64        `json:"new_price,omitempty"`
+	OldQuantity  int            `json:"old_quantity,omitempty"`
+	NewQuantity  int            `json:"new_quantity,omitempty"`
+}
+
+// RefreshCart revalidates a cart against live products: snapshots are updated,
+// deleted and sold-out products are removed and quantities are clamped to the
+// available stock. It returns the remaining items and what changed.
+func RefreshCart(db *gorm.DB, cartID uint) ([]models.CartItem, []CartChange, error) {
+	items := []models.CartItem{}
+	changes := []CartChange{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current []models.CartItem
+		if err := tx.Where("cart_id = ?", cartID).Order("id").Find(&current).Error; err != nil {
+			return err
+		}
+
+		for _, item := range current {
+			line, err := refreshCartLine(tx, cartID, item.ProductID, item.ProductEName, item.ProductSalePrice, item.Quantity)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, line.Changes...)
+			if line.Removed {
+				if err := tx.Delete(&item).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			item.ProductEName = line.Product.EName
+			item.ProductArName = line.Product.ARName
+			item.ProductImage = line.Product.Image
+			item.ProductStock = line.Product.Stock
+			item.ProductSalePrice = line.Price
+			item.ProductRegularPrice = line.Product.RegularPrice
+			item.Weight = line.Product.Weight
+			item.Quantity = line.Quantity
+			if err := tx.Save(&item).Error; err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, changes, nil
+}
+
+// RefreshGuestCart is RefreshCart for a guest cart
+func RefreshGuestCart(db *gorm.DB, cartID uint) ([]models.GuestCartItem, []CartChange, error) {
+	items := []models.GuestCartItem{}
+	changes := []CartChange{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current []models.GuestCartItem
+		if err := tx.Where("cart_id = ?", cartID).Order("id").Find(&current).Error; err != nil {
+			return err
+		}
+
+		for _, item := range current {
+			// Guests can't check out, so no reservations are theirs
+			line, err := refreshCartLine(tx, 0, item.ProductID, item.ProductEName, item.ProductSalePrice, item.Quantity)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, line.Changes...)
+			if line.Removed {
+				if err := tx.Delete(&item).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			item.ProductEName = line.Product.EName
+			item.ProductArName = line.Product.ARName
+			item.ProductImage = line.Product.Image
+			item.ProductStock = line.Product.Stock
+			item.ProductSalePrice = line.Price
+			item.ProductRegularPrice = line.Product.RegularPrice
+			item.Weight = line.Product.Weight
+			item.Quantity = line.Quantity
+			if err := tx.Save(&item).Error; err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, changes, nil
+}
+
+// cartLineRefresh is what refreshing one cart line found
+type cartLineRefresh struct {
+	Product  models.Product
+	Price    float64 // effective price now
+	Quantity int     // quantity clamped to the available stock
+	Removed  bool    // the product is gone or sold out; drop the line
+	Changes  []CartChange
+}
+
+// refreshCartLine checks a cart line, with its snapshot price and quantity, against
+// the live product. Stock reserved by cartID counts as available to it.
+func refreshCartLine(tx *gorm.DB, cartID, productID uint, productEName string, snapshotPrice float64, quantity int) (cartLineRefresh, error) {
+	var line cartLineRefresh
+	if err := tx.First(&line.Product, "id = ?", productID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return line, err
+		}
+		line.Removed = true
+		line.Changes = append(line.Changes, CartChange{
+			ProductID:    productID,
+			ProductEName: productEName,
+			Type:         CartItemRemoved,
+			OldQuantity:  quantity,
+		})
+		return line, nil
+	}
+	product := line.Product
+
+	available, err := AvailableStock(tx, product, cartID)
+	if err != nil {
+		return line, err
+	}
+	if available <= 0 {
+		line.Removed = true
+		line.Changes = append(line.Changes, CartChange{
+			ProductID:    product.ID,
+			ProductEName: product.EName,
+			Type:         CartItemOutOfStock,
+			OldQuantity:  quantity,
+		})
+		return line, nil
+	}
+
+	line.Price, _, err = models.EffectivePrice(tx, product)
+	if err != nil {
+		return line, err
+	}
+	if RoundMoney(snapshotPrice) != RoundMoney(line.Price) {
+		line.Changes = append(line.Changes, CartChange{
+			ProductID:    product.ID,
+			ProductEName: product.EName,
+			Type:         CartItemPriceChanged,
+			OldPrice:     snapshotPrice,
+			NewPrice:     line.Price,
+		})
+	}
+	line.Quantity = quantity
+	if quantity > available {
+		line.Changes = append(line.Changes, CartChange{
+			ProductID:    product.ID,
+			ProductEName: product.EName,
+			Type:         CartItemQuantityReduced,
+			OldQuantity:  quantity,
+			NewQuantity:  available,
+		})
+		line.Quantity = available
+	}
+	return line, nil
+}
+
+// CartChangedError is returned at checkout when refreshing the cart changed it,
+// so the customer can review the new cart before paying.
+type CartChangedError struct {
+	Changes []CartChange
+}
+
+func (e CartChangedError) Error() string {
+	return "cart changed since it was last viewed"
+}
+
+// RefreshCartForCheckout refreshes the cart and fails with CartChangedError if
+// anything the customer would pay for changed.
+func RefreshCartForCheckout(db *gorm.DB, cartID uint) ([]models.CartItem, error) {
+	items, changes, err := RefreshCart(db, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		return nil, CartChangedError{Changes: changes}
+	}
+	if len(items) == 0 {
+		return nil, errors.New("cart is empty")
+	}
+	return items, nil
+}
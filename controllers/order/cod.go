@@ -0,0 +1,117 @@
+package orderControllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/middleware"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errCODOnly           = errors.New("order is not cash on delivery")
+	errCODAlreadySettled = errors.New("payment already settled for this order")
+)
+
+// PlaceCODOrderHandler checks out the authenticated user's cart as cash on delivery.
+// The order is created pending/pending and its stock is taken immediately.
+// POST /payment/cod
+func PlaceCODOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDVal, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		userID, _ := userIDVal.(string)
+
+		var cart models.Cart
+		if err := db.Where("user_id = ?", userID).First(&cart).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User cart not found"})
+			return
+		}
+
+		// A card payment for this cart is in flight: don't place a second order for it
+		if err := CheckCartEditable(db, cart.CartID); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrCheckoutInProgress) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		// The customer must see any price or stock changes before the order is placed
+		if _, err := RefreshCartForCheckout(db, cart.CartID); err != nil {
+			var changed CartChangedError
+			if errors.As(err, &changed) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "changes": changed.Changes})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cartID := strconv.FormatUint(uint64(cart.CartID), 10)
+		placed, err := PlaceOrder(db, cartID,
+			string(models.OrderStatusPending), string(models.PaymentStatusPending), models.PaymentMethodCOD)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		placed.Announce()
+
+		c.JSON(http.StatusCreated, placed.Order)
+	}
+}
+
+// MarkCODCollectedHandler records that cash was collected for a COD order on delivery.
+// POST /admin/orders/:orderID/cod-collected
+func MarkCODCollectedHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID := c.Param("orderID")
+
+		status := http.StatusInternalServerError
+		var order models.Order
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", orderID).Error; err != nil {
+				status = http.StatusNotFound
+				return err
+			}
+
+			if order.PaymentMethod != models.PaymentMethodCOD {
+				status = http.StatusBadRequest
+				return errCODOnly
+			}
+			if order.PaymentStatus != models.PaymentStatusPending {
+				status = http.StatusConflict
+				return errCODAlreadySettled
+			}
+
+			// Cash is collected on delivery: move the order to delivered if it isn't already
+			if order.Status != models.OrderStatusDelivered {
+				if err := ChangeOrderStatus(tx, &order, models.OrderStatusDelivered, middleware.Actor(c), "cash collected on delivery"); err != nil {
+					status = http.StatusConflict
+					return err
+				}
+			}
+
+			order.PaymentStatus = models.PaymentStatusPaid
+			return tx.Model(&order).Update("payment_status", order.PaymentStatus).Error
+		})
+		if err != nil {
+			if status == http.StatusNotFound {
+				c.JSON(status, gin.H{"error": "Order not found"})
+				return
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Cash collected", "order": order})
+	}
+}
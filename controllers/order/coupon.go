@@ -0,0 +1,348 @@
+package orderControllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCouponNotApplicable is returned when a coupon can't be used on a cart
+var ErrCouponNotApplicable = errors.New("coupon cannot be applied")
+
+// CouponLine is a priced cart or order line a coupon may discount
+type CouponLine struct {
+	ProductID uint
+	Amount    float64
+}
+
+// NormalizeCouponCode makes coupon codes case-insensitive
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// FindCoupon loads a coupon with its scoping by code
+func FindCoupon(db *gorm.DB, code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := db.Preload("Categories").Preload("Products").
+		Where("code = ?", NormalizeCouponCode(code)).First(&coupon).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: coupon %s not found", ErrCouponNotApplicable, NormalizeCouponCode(code))
+		}
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// CouponDiscount checks a coupon against its validity window, usage limits and
+// minimum cart value, and returns the discount it gives on the lines.
+// Percentage and fixed discounts only apply to lines in the coupon's scope;
+// free-shipping coupons discount the shipping cost.
+func CouponDiscount(db *gorm.DB, coupon *models.Coupon, userID string, lines []CouponLine, subtotal, shippingCost float64) (float64, error) {
+	notApplicable := func(reason string) error {
+		return fmt.Errorf("%w: %s", ErrCouponNotApplicable, reason)
+	}
+
+	now := time.Now()
+	if !coupon.Active {
+		return 0, notApplicable("coupon is not active")
+	}
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return 0, notApplicable("coupon is not valid yet")
+	}
+	if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+		return 0, notApplicable("coupon has expired")
+	}
+	if subtotal < coupon.MinCartValue {
+		return 0, notApplicable(fmt.Sprintf("cart must be at least %.2f", coupon.MinCartValue))
+	}
+
+	if coupon.UsageLimit > 0 {
+		var used int64
+		if err := db.Model(&models.CouponRedemption{}).Where("coupon_id = ?", coupon.ID).Count(&used).Error; err != nil {
+			return 0, err
+		}
+		if used >= int64(coupon.UsageLimit) {
+			return 0, notApplicable("coupon usage limit reached")
+		}
+	}
+	if coupon.PerUserLimit > 0 {
+		var used int64
+		if err := db.Model(&models.CouponRedemption{}).
+			Where("coupon_id = ? AND user_id = ?", coupon.ID, userID).Count(&used).Error; err != nil {
+			return 0, err
+		}
+		if used >= int64(coupon.PerUserLimit) {
+			return 0, notApplicable("coupon already used")
+		}
+	}
+
+	if coupon.Type == models.CouponFreeShipping {
+		return shippingCost, nil
+	}
+
+	eligible, err := eligibleAmount(db, coupon, lines)
+	if err != nil {
+		return 0, err
+	}
+	if eligible <= 0 {
+		return 0, notApplicable("no items in the cart qualify for this coupon")
+	}
+
+	var discount float64
+	switch coupon.Type {
+	case models.CouponPercent:
+		discount = eligible * coupon.Value / 100
+		if coupon.MaxDiscount > 0 {
+			discount = math.Min(discount, coupon.MaxDiscount)
+		}
+	case models.CouponFixed:
+		discount = math.Min(coupon.Value, eligible)
+	default:
+		return 0, notApplicable("unknown coupon type")
+	}
+	return RoundMoney(discount), nil
+}
+
+// eligibleAmount sums the lines in the coupon's product and category scope.
+// Categories cover their subcategories too.
+func eligibleAmount(db *gorm.DB, coupon *models.Coupon, lines []CouponLine) (float64, error) {
+	if len(coupon.Products) == 0 && len(coupon.Categories) == 0 {
+		var total float64
+		for _, line := range lines {
+			total += line.Amount
+		}
+		return total, nil
+	}
+
+	inScope := make(map[uint]bool)
+	for _, p := range coupon.Products {
+		inScope[p.ID] = true
+	}
+	if len(coupon.Categories) > 0 {
+		var categoryIDs, productIDs []uint
+		for _, cat := range coupon.Categories {
+			categoryIDs = append(categoryIDs, cat.ID)
+		}
+		for _, line := range lines {
+			productIDs = append(productIDs, line.ProductID)
+		}
+
+		var matched []uint
+		if err := db.Table("product_categories").
+			Where("category_id IN ("+models.CategoryDescendantsSQL+") AND product_id IN ?", categoryIDs, productIDs).
+			Distinct().Pluck("product_id", &matched).Error; err != nil {
+			return 0, err
+		}
+		for _, id := range matched {
+			inScope[id] = true
+		}
+	}
+
+	var total float64
+	for _, line := range lines {
+		if inScope[line.ProductID] {
+			total += line.Amount
+		}
+	}
+	return total, nil
+}
+
+// redeemCoupon re-checks a coupon under a row lock while an order is placed, so
+// concurrent orders can't exceed its usage limits, and returns the discount.
+func redeemCoupon(tx *gorm.DB, code, userID string, lines []CouponLine, subtotal, shippingCost float64) (*models.Coupon, float64, error) {
+	coupon, err := FindCoupon(tx, code)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Coupon{}, coupon.ID).Error; err != nil {
+		return nil, 0, err
+	}
+
+	discount, err := CouponDiscount(tx, coupon, userID, lines, subtotal, shippingCost)
+	if err != nil {
+		return nil, 0, err
+	}
+	return coupon, discount, nil
+}
+
+// CouponInput is the admin payload for creating or updating a coupon
+type CouponInput struct {
+	Code         string            `json:"code" binding:"required"`
+	Description  string            `json:"description"`
+	Type         models.CouponType `json:"type" binding:"required,oneof=percent fixed free_shipping"`
+	Value        float64           `json:"value" binding:"min=0"`
+	MaxDiscount  float64           `json:"max_discount" binding:"min=0"`
+	MinCartValue float64           `json:"min_cart_value" binding:"min=0"`
+	StartsAt     *time.Time        `json:"starts_at"`
+	EndsAt       *time.Time        `json:"ends_at"`
+	UsageLimit   int               `json:"usage_limit" binding:"min=0"`
+	PerUserLimit int               `json:"per_user_limit" binding:"min=0"`
+	Active       *bool             `json:"active"`
+	CategoryIDs  []uint            `json:"category_ids"`
+	ProductIDs   []uint            `json:"product_ids"`
+}
+
+// apply copies the input onto a coupon and loads its scoping
+func (in CouponInput) apply(db *gorm.DB, coupon *models.Coupon) error {
+	if in.Type == models.CouponPercent && in.Value > 100 {
+		return errors.New("percentage cannot exceed 100")
+	}
+	if in.StartsAt != nil && in.EndsAt != nil && !in.EndsAt.After(*in.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	coupon.Code = NormalizeCouponCode(in.Code)
+	coupon.Description = in.Description
+	coupon.Type = in.Type
+	coupon.Value = in.Value
+	coupon.MaxDiscount = in.MaxDiscount
+	coupon.MinCartValue = in.MinCartValue
+	coupon.StartsAt = in.StartsAt
+	coupon.EndsAt = in.EndsAt
+	coupon.UsageLimit = in.UsageLimit
+	coupon.PerUserLimit = in.PerUserLimit
+	coupon.Active = in.Active == nil || *in.Active
+
+	coupon.Categories = []models.Category{}
+	if len(in.CategoryIDs) > 0 {
+		if err := db.Where("id IN ?", in.CategoryIDs).Find(&coupon.Categories).Error; err != nil {
+			return err
+		}
+	}
+	coupon.Products = []models.Product{}
+	if len(in.ProductIDs) > 0 {
+		if err := db.Where("id IN ?", in.ProductIDs).Find(&coupon.Products).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCoupons lists coupons with their redemption counts.
+// GET /admin/coupons
+func GetCoupons(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var coupons []models.Coupon
+		if err := db.Preload("Categories").Preload("Products").Order("created_at DESC").Find(&coupons).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupons"})
+			return
+		}
+
+		var counts []struct {
+			CouponID uint
+			Used     int
+		}
+		if err := db.Model(&models.CouponRedemption{}).Select("coupon_id, COUNT(*) AS used").
+			Group("coupon_id").Scan(&counts).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch coupon usage"})
+			return
+		}
+		used := make(map[uint]int, len(counts))
+		for _, row := range counts {
+			used[row.CouponID] = row.Used
+		}
+
+		result := make([]gin.H, 0, len(coupons))
+		for _, coupon := range coupons {
+			result = append(result, gin.H{"coupon": coupon, "used": used[coupon.ID]})
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// CreateCoupon adds a coupon.
+// POST /admin/coupons
+func CreateCoupon(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input CouponInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var coupon models.Coupon
+		if err := input.apply(db, &coupon); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Select("*") so an explicit "active": false isn't replaced by the column default
+		if err := db.Select("*").Create(&coupon).Error; err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Failed to create coupon", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, coupon)
+	}
+}
+
+// UpdateCoupon replaces a coupon's settings and scoping.
+// PUT /admin/coupons/:id
+func UpdateCoupon(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var coupon models.Coupon
+		if err := db.First(&coupon, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+			return
+		}
+
+		var input CouponInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := input.apply(db, &coupon); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit("Categories", "Products").Save(&coupon).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&coupon).Association("Categories").Replace(coupon.Categories); err != nil {
+				return err
+			}
+			return tx.Model(&coupon).Association("Products").Replace(coupon.Products)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update coupon", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, coupon)
+	}
+}
+
+// DeleteCoupon removes a coupon. Orders keep the code and discount they were placed with.
+// DELETE /admin/coupons/:id
+func DeleteCoupon(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var coupon models.Coupon
+		if err := db.First(&coupon, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&coupon).Association("Categories").Clear(); err != nil {
+				return err
+			}
+			if err := tx.Model(&coupon).Association("Products").Clear(); err != nil {
+				return err
+			}
+			return tx.Delete(&coupon).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete coupon"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Coupon deleted"})
+	}
+}
@@ -0,0 +1,176 @@
+package orderControllers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/junaidrashid-git/ecommerce-api/internal/testdb"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+func TestCouponDiscount(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	lines := []CouponLine{{ProductID: 1, Amount: 120}, {ProductID: 2, Amount: 80}}
+
+	tests := []struct {
+		name    string
+		coupon  models.Coupon
+		want    float64
+		wantErr bool
+	}{
+		{"percent", models.Coupon{Active: true, Type: models.CouponPercent, Value: 10}, 20, false},
+		{"percent rounded", models.Coupon{Active: true, Type: models.CouponPercent, Value: 12.345}, 24.69, false},
+		{"percent capped", models.Coupon{Active: true, Type: models.CouponPercent, Value: 50, MaxDiscount: 30}, 30, false},
+		{"percent under cap", models.Coupon{Active: true, Type: models.CouponPercent, Value: 10, MaxDiscount: 30}, 20, false},
+		{"fixed", models.Coupon{Active: true, Type: models.CouponFixed, Value: 25}, 25, false},
+		{"fixed above subtotal", models.Coupon{Active: true, Type: models.CouponFixed, Value: 500}, 200, false},
+		{"free shipping", models.Coupon{Active: true, Type: models.CouponFreeShipping}, 15, false},
+		{"minimum spend met", models.Coupon{Active: true, Type: models.CouponFixed, Value: 25, MinCartValue: 200}, 25, false},
+		{"minimum spend missed", models.Coupon{Active: true, Type: models.CouponFixed, Value: 25, MinCartValue: 200.01}, 0, true},
+		{"inactive", models.Coupon{Type: models.CouponFixed, Value: 25}, 0, true},
+		{"not started", models.Coupon{Active: true, Type: models.CouponFixed, Value: 25, StartsAt: &future}, 0, true},
+		{"expired", models.Coupon{Active: true, Type: models.CouponFixed, Value: 25, EndsAt: &past}, 0, true},
+		{"within window", models.Coupon{Active: true, Type: models.CouponFixed, Value: 25, StartsAt: &past, EndsAt: &future}, 25, false},
+		{"unknown type", models.Coupon{Active: true, Type: "bogo", Value: 25}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coupon := tt.coupon
+
+			// Unscoped coupons without usage limits never touch the database
+			got, err := CouponDiscount(nil, &coupon, "u1", lines, 200, 15)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCouponNotApplicable) {
+					t.Errorf("got %.2f, %v; want ErrCouponNotApplicable", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %.2f, %v; want %.2f", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// seedCouponCatalog creates Kitchen > Pans and Garden categories with a pan in Pans,
+// a mug in Kitchen and an uncategorised shirt, and returns them by name.
+func seedCouponCatalog(t *testing.T, db *gorm.DB) (map[string]models.Category, map[string]models.Product) {
+	t.Helper()
+	kitchen := models.Category{EName: "Kitchen", ARName: "مطبخ"}
+	garden := models.Category{EName: "Garden", ARName: "حديقة"}
+	for _, cat := range []*models.Category{&kitchen, &garden} {
+		if err := db.Create(cat).Error; err != nil {
+			t.Fatalf("create category: %v", err)
+		}
+	}
+	pans := models.Category{EName: "Pans", ARName: "مقالي", ParentID: &kitchen.ID}
+	if err := db.Create(&pans).Error; err != nil {
+		t.Fatalf("create category: %v", err)
+	}
+
+	products := map[string]models.Product{
+		"pan":   {EName: "Pan", Image: "/pan.png", SalePrice: 100, Weight: 1, Categories: []models.Category{pans}},
+		"mug":   {EName: "Mug", Image: "/mug.png", SalePrice: 40, Weight: 1, Categories: []models.Category{kitchen}},
+		"shirt": {EName: "Shirt", Image: "/shirt.png", SalePrice: 60, Weight: 1},
+	}
+	for name, p := range products {
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create product: %v", err)
+		}
+		products[name] = p
+	}
+	return map[string]models.Category{"kitchen": kitchen, "pans": pans, "garden": garden}, products
+}
+
+func TestCouponDiscountScope(t *testing.T) {
+	db := testdb.Open(t)
+	cats, products := seedCouponCatalog(t, db)
+	lines := []CouponLine{
+		{ProductID: products["pan"].ID, Amount: 100},
+		{ProductID: products["mug"].ID, Amount: 40},
+		{ProductID: products["shirt"].ID, Amount: 60},
+	}
+
+	tests := []struct {
+		name       string
+		categories []string
+		products   []string
+		percent    float64
+		want       float64
+		wantErr    bool
+	}{
+		{"whole cart", nil, nil, 10, 20, false},
+		{"category covers its subcategories", []string{"kitchen"}, nil, 10, 14, false},
+		{"subcategory only", []string{"pans"}, nil, 10, 10, false},
+		{"product", nil, []string{"shirt"}, 50, 30, false},
+		{"category and product", []string{"pans"}, []string{"shirt"}, 50, 80, false},
+		{"nothing in scope", []string{"garden"}, nil, 10, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coupon := models.Coupon{Type: models.CouponPercent, Value: tt.percent, Active: true}
+			for _, name := range tt.categories {
+				coupon.Categories = append(coupon.Categories, cats[name])
+			}
+			for _, name := range tt.products {
+				coupon.Products = append(coupon.Products, products[name])
+			}
+
+			got, err := CouponDiscount(db, &coupon, "u1", lines, 200, 15)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCouponNotApplicable) {
+					t.Errorf("got %.2f, %v; want ErrCouponNotApplicable", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %.2f, %v; want %.2f", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCouponDiscountUsageLimits(t *testing.T) {
+	db := testdb.Open(t)
+	lines := []CouponLine{{ProductID: 1, Amount: 100}}
+
+	tests := []struct {
+		name     string
+		coupon   models.Coupon
+		redeemer string // user with one earlier redemption
+		wantErr  bool
+	}{
+		{"under total limit", models.Coupon{Code: "TOTAL2", UsageLimit: 2}, "u2", false},
+		{"total limit reached", models.Coupon{Code: "TOTAL1", UsageLimit: 1}, "u2", true},
+		{"other user's redemption", models.Coupon{Code: "PERUSER1", PerUserLimit: 1}, "u2", false},
+		{"per-user limit reached", models.Coupon{Code: "MINE1", PerUserLimit: 1}, "u1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coupon := tt.coupon
+			coupon.Type = models.CouponFixed
+			coupon.Value = 10
+			coupon.Active = true
+			if err := db.Create(&coupon).Error; err != nil {
+				t.Fatalf("create coupon: %v", err)
+			}
+			if err := db.Create(&models.CouponRedemption{CouponID: coupon.ID, UserID: tt.redeemer, OrderID: 1, Discount: 10}).Error; err != nil {
+				t.Fatalf("create redemption: %v", err)
+			}
+
+			got, err := CouponDiscount(db, &coupon, "u1", lines, 100, 15)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCouponNotApplicable) {
+					t.Errorf("got %.2f, %v; want ErrCouponNotApplicable", got, err)
+				}
+				return
+			}
+			if err != nil || got != 10 {
+				t.Errorf("got %.2f, %v; want 10.00", got, err)
+			}
+		})
+	}
+}
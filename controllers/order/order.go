@@ -2,22 +2,23 @@ package orderControllers
 
 import (
 	"errors"
-	"math"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/middleware"
 	"github.com/junaidrashid-git/ecommerce-api/models"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-// Struct to receive client request
+// Struct to receive client request. Manual orders always start pending/pending
+// as cash on delivery; move them on through the status endpoints.
 type PlaceOrderRequest struct {
-	CartID        string `json:"cart_id" binding:"required"`
-	Status        string `json:"status" binding:"required"`         // e.g. "pending", "shipped"
-	PaymentStatus string `json:"payment_status" binding:"required"` // e.g. "paid", "failed"
+	CartID string `json:"cart_id" binding:"required"`
 }
 
 // Utility: map and validate status
@@ -53,97 +54,321 @@ func mapPaymentStatus(status string) (models.PaymentStatus, error) {
 		return models.PaymentStatusFailed, nil
 	case string(models.PaymentStatusRefunded):
 		return models.PaymentStatusRefunded, nil
+	case string(models.PaymentStatusPartiallyRefunded):
+		return models.PaymentStatusPartiallyRefunded, nil
 	default:
 		return "", errors.New("invalid payment status")
 	}
 }
 
-// Place order from a given CartID (used for webhook or API)
-func PlaceOrder(db *gorm.DB, cartID, status, paymentStatus string) error {
+// PlacedOrder is an order saved by PlaceOrder or PlaceSessionOrder. Admin clients
+// must only hear about it once it is committed, so call Announce after the
+// outermost transaction it was placed in succeeds.
+type PlacedOrder struct {
+	Order    *models.Order
+	LowStock []models.Product // products the sale took down to their reorder threshold
+}
+
+// Announce broadcasts the placed order and its low-stock alerts to admin clients
+func (p *PlacedOrder) Announce() {
+	go BroadcastNewOrder(*p.Order)
+	for _, product := range p.LowStock {
+		go BroadcastLowStock(product)
+	}
+}
+
+// Place order from a given CartID at live prices (used for COD or API)
+func PlaceOrder(db *gorm.DB, cartID, status, paymentStatus, paymentMethod string) (*PlacedOrder, error) {
 	var cart models.Cart
 	err := db.Preload("Items").Where("cart_id = ?", cartID).First(&cart).Error
 	if err != nil {
-		return errors.New("cart not found for cartID: " + cartID)
+		return nil, errors.New("cart not found for cartID: " + cartID)
 	}
 	if len(cart.Items) == 0 {
-		return errors.New("cart is empty")
+		return nil, errors.New("cart is empty")
 	}
 
-	mappedOrderStatus, _ := mapOrderStatus(status)
-	mappedPaymentStatus, _ := mapPaymentStatus(paymentStatus)
+	mappedOrderStatus, err := mapOrderStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	mappedPaymentStatus, err := mapPaymentStatus(paymentStatus)
+	if err != nil {
+		return nil, err
+	}
 
 	var total, totalWeight float64
 	var orderItems []models.OrderItem
+	var sold []models.Product     // product rows after the sale, for the stock ledger
+	var lowStock []models.Product // products this sale took down to their reorder threshold
+	var order models.Order
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Units reserved at checkout are already ours: they become the sale
+		held, err := heldStock(tx, "cart_id = ?", cart.CartID)
+		if err != nil {
+			return err
+		}
 
-	return db.Transaction(func(tx *gorm.DB) error {
 		for _, item := range cart.Items {
-			var product models.Product
-			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, "id = ?", item.ProductID).Error; err != nil {
+			product, crossed, err := takeStock(tx, item.ProductID, item.Quantity, held, cart.CartID)
+			if err != nil {
 				return err
 			}
-
-			if product.Stock < item.Quantity {
-				return errors.New("insufficient stock for product: " + product.EName)
+			sold = append(sold, product)
+			if crossed {
+				lowStock = append(lowStock, product)
 			}
 
-			product.Stock -= item.Quantity
-			if err := tx.Save(&product).Error; err != nil {
+			// Charge the live product price, including any running sale,
+			// not the snapshot taken when the item was added
+			price, _, err := models.EffectivePrice(tx, product)
+			if err != nil {
 				return err
 			}
-
-			total += item.ProductSalePrice * float64(item.Quantity)
-			totalWeight += item.Weight * float64(item.Quantity)
+			total += price * float64(item.Quantity)
+			totalWeight += product.Weight * float64(item.Quantity)
 
 			orderItems = append(orderItems, models.OrderItem{
 				ProductID:           item.ProductID,
-				ProductEName:        item.ProductEName,
-				ProductArName:       item.ProductArName,
-				ProductImage:        item.ProductImage,
-				ProductSalePrice:    item.ProductSalePrice,
-				ProductRegularPrice: item.ProductRegularPrice,
-				Weight:              item.Weight,
+				ProductEName:        product.EName,
+				ProductArName:       product.ARName,
+				ProductImage:        product.Image,
+				ProductSalePrice:    price,
+				ProductRegularPrice: product.RegularPrice,
+				Weight:              product.Weight,
 				Quantity:            item.Quantity,
 			})
 		}
 
-		// === Shipping cost pattern (same as your Flutter logic) ===
-		var shippingCost float64
-		if totalWeight <= 0 {
-			shippingCost = 0.0
-		} else if totalWeight <= 29 {
-			shippingCost = 30.0
-		} else if totalWeight <= 59 {
-			shippingCost = 60.0
-		} else if totalWeight <= 89 {
-			shippingCost = 90.0
-		} else {
-			extraBlocks := int(math.Ceil((totalWeight - 89) / 30.0))
-			shippingCost = 90.0 + float64(extraBlocks*30)
+		dest, err := UserShippingAddress(tx, cart.UserID)
+		if err != nil {
+			return err
 		}
+		quote, err := QuoteShipping(tx, dest, totalWeight, RoundMoney(total))
+		if err != nil {
+			return err
+		}
+		shippingCost := quote.Cost
+
+		// Apply the cart's coupon, counting this order towards its usage limits
+		var coupon *models.Coupon
+		var discount float64
+		if cart.CouponCode != "" {
+			lines := make([]CouponLine, 0, len(orderItems))
+			for _, item := range orderItems {
+				lines = append(lines, CouponLine{ProductID: item.ProductID, Amount: RoundMoney(item.ProductSalePrice * float64(item.Quantity))})
+			}
+			if coupon, discount, err = redeemCoupon(tx, cart.CouponCode, cart.UserID, lines, RoundMoney(total), shippingCost); err != nil {
+				return err
+			}
+		}
+		totalWithShipping := RoundMoney(total + shippingCost - discount)
 
-		totalWithShipping := total + shippingCost
-
-		order := models.Order{
+		order = models.Order{
 			UserID:        cart.UserID,
 			Items:         orderItems,
 			TotalAmount:   totalWithShipping,
 			ShippingCost:  shippingCost,
+			CouponCode:    cart.CouponCode,
+			Discount:      discount,
 			Status:        mappedOrderStatus,
 			PaymentStatus: mappedPaymentStatus,
-			CreatedAt:     time.Now(),
+			PaymentMethod: paymentMethod,
+			StatusHistory: []models.OrderStatusHistory{
+				{ToStatus: mappedOrderStatus, Actor: "system", Note: "order placed"},
+			},
+			CreatedAt: time.Now(),
 		}
 
-		if err := tx.Create(&order).Error; err != nil {
+		if err := saveOrder(tx, &order, cart.CartID, sold, coupon); err != nil {
 			return err
 		}
 
-		if err := tx.Where("cart_id = ?", cart.CartID).Delete(&models.CartItem{}).Error; err != nil {
+		return tx.Model(&models.StockReservation{}).
+			Where("cart_id = ? AND status = ?", cart.CartID, models.StockReservationActive).
+			Update("status", models.StockReservationConverted).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PlacedOrder{Order: &order, LowStock: lowStock}, nil
+}
+
+// PlaceSessionOrder places the order a payment session was priced for at checkout.
+// It charges exactly the session's lines, shipping and discount, whatever the cart
+// or product prices are now, and takes stock from the session's reservations.
+// session.Items must be loaded.
+func PlaceSessionOrder(db *gorm.DB, session *models.PaymentSession, status, paymentStatus, paymentMethod string) (*PlacedOrder, error) {
+	if len(session.Items) == 0 {
+		return nil, errors.New("payment session has no items")
+	}
+
+	mappedOrderStatus, err := mapOrderStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	mappedPaymentStatus, err := mapPaymentStatus(paymentStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	var subtotal float64
+	var orderItems []models.OrderItem
+	for _, item := range session.Items {
+		subtotal += RoundMoney(item.UnitPrice * float64(item.Quantity))
+		orderItems = append(orderItems, models.OrderItem{
+			ProductID:           item.ProductID,
+			ProductEName:        item.ProductEName,
+			ProductArName:       item.ProductArName,
+			ProductImage:        item.ProductImage,
+			ProductSalePrice:    item.UnitPrice,
+			ProductRegularPrice: item.RegularPrice,
+			Weight:              item.Weight,
+			Quantity:            item.Quantity,
+		})
+	}
+	total := RoundMoney(subtotal + session.ShippingCost - session.Discount)
+	if total != RoundMoney(session.Amount) {
+		return nil, fmt.Errorf("session lines total %.2f, expected %.2f", total, session.Amount)
+	}
+
+	var sold []models.Product
+	var lowStock []models.Product
+	var order models.Order
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		held, err := heldStock(tx, "payment_session_id = ?", session.ID)
+		if err != nil {
 			return err
 		}
 
-		go BroadcastNewOrder(order)
-		return nil
+		for _, item := range session.Items {
+			product, crossed, err := takeStock(tx, item.ProductID, item.Quantity, held, session.CartID)
+			if err != nil {
+				return err
+			}
+			sold = append(sold, product)
+			if crossed {
+				lowStock = append(lowStock, product)
+			}
+		}
+
+		// The discount was paid for at checkout, so it is honoured even if the
+		// coupon has since expired or run out; the redemption still counts.
+		var coupon *models.Coupon
+		if session.CouponCode != "" {
+			coupon, err = FindCoupon(tx, session.CouponCode)
+			if err != nil && !errors.Is(err, ErrCouponNotApplicable) {
+				return err
+			}
+		}
+
+		order = models.Order{
+			UserID:        session.UserID,
+			Items:         orderItems,
+			TotalAmount:   total,
+			ShippingCost:  session.ShippingCost,
+			CouponCode:    session.CouponCode,
+			Discount:      session.Discount,
+			Status:        mappedOrderStatus,
+			PaymentStatus: mappedPaymentStatus,
+			PaymentMethod: paymentMethod,
+			StatusHistory: []models.OrderStatusHistory{
+				{ToStatus: mappedOrderStatus, Actor: "system", Note: "order placed for payment " + session.Reference},
+			},
+			CreatedAt: time.Now(),
+		}
+
+		if err := saveOrder(tx, &order, session.CartID, sold, coupon); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.StockReservation{}).
+			Where("payment_session_id = ? AND status = ?", session.ID, models.StockReservationActive).
+			Update("status", models.StockReservationConverted).Error
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PlacedOrder{Order: &order, LowStock: lowStock}, nil
+}
+
+// takeStock locks a product and deducts the units sold. Units held for this sale
+// are used first; the rest must be available net of other carts' reservations.
+// It also reports whether the sale took the product down to its reorder threshold.
+func takeStock(tx *gorm.DB, productID uint, quantity int, held map[uint]int, cartID uint) (models.Product, bool, error) {
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, "id = ?", productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return product, false, fmt.Errorf("product %d no longer available", productID)
+		}
+		return product, false, err
+	}
+
+	if held[productID] >= quantity {
+		held[productID] -= quantity
+	} else {
+		available, err := AvailableStock(tx, product, cartID)
+		if err != nil {
+			return product, false, err
+		}
+		if available < quantity {
+			return product, false, errors.New("insufficient stock for product: " + product.EName)
+		}
+	}
+	if product.Stock < quantity {
+		return product, false, errors.New("insufficient stock for product: " + product.EName)
+	}
+
+	wasLow := product.LowStock()
+	product.Stock -= quantity
+	if err := tx.Save(&product).Error; err != nil {
+		return product, false, err
+	}
+	return product, !wasLow && product.LowStock(), nil
+}
+
+// saveOrder creates an order with its stock ledger entries and coupon redemption,
+// and removes the sold products and the used coupon from the cart.
+// sold holds the product rows after the sale, in the order of order.Items.
+func saveOrder(tx *gorm.DB, order *models.Order, cartID uint, sold []models.Product, coupon *models.Coupon) error {
+	if err := tx.Create(order).Error; err != nil {
+		return err
+	}
+
+	productIDs := make([]uint, 0, len(order.Items))
+	for i, item := range order.Items {
+		productIDs = append(productIDs, item.ProductID)
+		if err := models.RecordStockMovement(tx, item.ProductID, -item.Quantity, sold[i].Stock,
+			models.StockMovementSale, strconv.FormatUint(uint64(order.ID), 10), order.UserID); err != nil {
+			return err
+		}
+	}
+
+	if coupon != nil {
+		if err := tx.Create(&models.CouponRedemption{
+			CouponID: coupon.ID,
+			UserID:   order.UserID,
+			OrderID:  order.ID,
+			Discount: order.Discount,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Where("cart_id = ? AND product_id IN ?", cartID, productIDs).Delete(&models.CartItem{}).Error; err != nil {
+		return err
+	}
+	if order.CouponCode != "" {
+		if err := tx.Model(&models.Cart{}).Where("cart_id = ? AND coupon_code = ?", cartID, order.CouponCode).
+			Update("coupon_code", "").Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // HTTP handler to place order
@@ -155,10 +380,13 @@ func PlaceOrderHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := PlaceOrder(db, req.CartID, req.Status, req.PaymentStatus); err != nil {
+		placed, err := PlaceOrder(db, req.CartID,
+			string(models.OrderStatusPending), string(models.PaymentStatusPending), models.PaymentMethodCOD)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		placed.Announce()
 
 		c.JSON(http.StatusOK, gin.H{"message": "Order placed successfully"})
 	}
@@ -176,7 +404,7 @@ func GetAllOrdersHandler(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// Handler for fetching a user's orders
+// Handler for fetching a user's orders. Users may only read their own orders.
 func GetUserOrdersHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.Param("userID")
@@ -184,6 +412,12 @@ func GetUserOrdersHandler(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "userID is required"})
 			return
 		}
+
+		tokenUserID, _ := c.Get("user_id")
+		if tokenUserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only view your own orders"})
+			return
+		}
 		orders, err := GetUserOrders(db, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -196,20 +430,26 @@ func GetUserOrdersHandler(db *gorm.DB) gin.HandlerFunc {
 // Fetch all orders with related user and items
 func GetAllOrders(db *gorm.DB) ([]models.Order, error) {
 	var orders []models.Order
-	err := db.Preload("Items").Preload("User").Order("created_at DESC").Find(&orders).Error
+	err := db.Preload("Items").Preload("User").Preload("StatusHistory", preloadStatusHistory).
+		Order("created_at DESC").Find(&orders).Error
 	return orders, err
 }
 
 // Fetch user-specific orders
 func GetUserOrders(db *gorm.DB, userID string) ([]models.Order, error) {
 	var orders []models.Order
-	err := db.Where("user_id = ?", userID).Preload("Items").Order("created_at DESC").Find(&orders).Error
+	err := db.Where("user_id = ?", userID).Preload("Items").Preload("StatusHistory", preloadStatusHistory).
+		Order("created_at DESC").Find(&orders).Error
 	return orders, err
 }
 
 // Request struct to update order status
 type UpdateOrderStatusRequest struct {
 	Status string `json:"status" binding:"required"` // e.g. "shipped", "cancelled"
+	Note   string `json:"note"`                      // e.g. tracking number, cancellation reason
+	// Restock selects what goes back on sale when status is "returned";
+	// omit it to restock everything. Cancellations always restock everything.
+	Restock []RestockLine `json:"restock"`
 }
 
 // Handler to update order status
@@ -233,18 +473,50 @@ func UpdateOrderStatusHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Model(&models.Order{}).Where("id = ?", orderID).Update("status", newStatus).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order status"})
+		var order models.Order
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&order, "id = ?", orderID).Error; err != nil {
+				return err
+			}
+			if err := ChangeOrderStatus(tx, &order, newStatus, middleware.Actor(c), req.Note); err != nil {
+				return err
+			}
+
+			// Give the units back to stock
+			switch newStatus {
+			case models.OrderStatusCancelled:
+				return RestockOrder(tx, &order, nil, models.StockMovementRestock, middleware.Actor(c))
+			case models.OrderStatusReturned:
+				return RestockOrder(tx, &order, req.Restock, models.StockMovementReturn, middleware.Actor(c))
+			}
+			return nil
+		})
+		if err != nil {
+			var transitionErr ErrInvalidTransition
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			case errors.As(err, &transitionErr):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, ErrInvalidRestock):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order status"})
+			}
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully"})
+		if err := db.Preload("Items").Preload("StatusHistory", preloadStatusHistory).First(&order, order.ID).Error; err != nil {
+			c.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully", "order": order})
 	}
 }
 
 // Request struct to update payment status
 type UpdatePaymentStatusRequest struct {
-	PaymentStatus string `json:"payment_status" binding:"required"` // e.g. "paid", "failed", "refunded"
+	PaymentStatus string `json:"payment_status" binding:"required"` // e.g. "paid", "failed"; refunds set their own statuses
 }
 
 // Handler to update the payment status of an order
@@ -269,6 +541,22 @@ func UpdatePaymentStatusHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Refund statuses only follow money actually returned through the refund endpoint
+		if newStatus == models.PaymentStatusRefunded || newStatus == models.PaymentStatusPartiallyRefunded {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refund the order through POST /admin/orders/:orderID/refunds instead"})
+			return
+		}
+
+		var order models.Order
+		if err := db.Select("id", "payment_status").First(&order, "id = ?", orderID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		if order.PaymentStatus == models.PaymentStatusRefunded || order.PaymentStatus == models.PaymentStatusPartiallyRefunded {
+			c.JSON(http.StatusConflict, gin.H{"error": "payment status of a refunded order is managed by its refunds"})
+			return
+		}
+
 		// Update payment_status field
 		if err := db.Model(&models.Order{}).Where("id = ?", orderID).Update("payment_status", newStatus).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update payment status"})
@@ -289,10 +577,25 @@ func DeleteOrderHandler(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		err := db.Transaction(func(tx *gorm.DB) error {
+			var order models.Order
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&order, "id = ?", orderID).Error; err != nil {
+				return err
+			}
+
+			// Goods that never left the warehouse go back on sale
+			if holdsWarehouseStock(order.Status) {
+				if err := RestockOrder(tx, &order, nil, models.StockMovementRestock, middleware.Actor(c)); err != nil {
+					return err
+				}
+			}
+
 			// Delete order items first (CASCADE should also handle this, but do it explicitly for safety)
 			if err := tx.Where("order_id = ?", orderID).Delete(&models.OrderItem{}).Error; err != nil {
 				return err
 			}
+			if err := tx.Where("order_id = ?", orderID).Delete(&models.OrderStatusHistory{}).Error; err != nil {
+				return err
+			}
 
 			// Delete order itself
 			if err := tx.Where("id = ?", orderID).Delete(&models.Order{}).Error; err != nil {
@@ -302,6 +605,10 @@ func DeleteOrderHandler(db *gorm.DB) gin.HandlerFunc {
 		})
 
 		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete order"})
 			return
 		}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,10 +23,24 @@ const (
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// tighten this for production if you can (check origin/host)
+	CheckOrigin: checkOrigin,
+}
+
+// checkOrigin accepts browser connections only from the server's own host or the
+// origins listed in WS_ALLOWED_ORIGINS (comma separated, e.g. https://admin.example.com).
+// Clients that send no Origin header, such as native apps, are let through.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
 		return true
-	},
+	}
+	for _, allowed := range strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
 
 // ---------- Hub ----------
@@ -168,6 +185,35 @@ func BroadcastNewOrder(order models.Order) {
 	globalHub.broadcast <- data
 }
 
+// LowStockAlert is sent over the order socket when a sale takes a product
+// to or below its reorder threshold. Type tells it apart from order messages.
+type LowStockAlert struct {
+	Type             string `json:"type"` // always "low_stock"
+	ProductID        uint   `json:"product_id"`
+	EName            string `json:"ename"`
+	ARName           string `json:"arname"`
+	Stock            int    `json:"stock"`
+	ReorderThreshold int    `json:"reorder_threshold"`
+}
+
+// BroadcastLowStock alerts all connected clients that a product needs restocking.
+func BroadcastLowStock(product models.Product) {
+	data, err := json.Marshal(LowStockAlert{
+		Type:             "low_stock",
+		ProductID:        product.ID,
+		EName:            product.EName,
+		ARName:           product.ARName,
+		Stock:            product.Stock,
+		ReorderThreshold: product.ReorderThreshold,
+	})
+	if err != nil {
+		log.Println("broadcast marshal error:", err)
+		return
+	}
+	log.Printf("[ws] BroadcastLowStock called for product id=%v stock=%v\n", product.ID, product.Stock)
+	globalHub.broadcast <- data
+}
+
 func init() {
 	// start hub loop
 	go globalHub.run()
@@ -0,0 +1,240 @@
+package orderControllers
+
+import (
+	"errors"
+	"math"
+
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// CartTotals is the server-side price of a cart, computed from live product rows
+// rather than the snapshots stored on the cart items.
+type CartTotals struct {
+	Items        []CartLine `json:"items"`
+	Subtotal     float64    `json:"subtotal"`
+	TotalWeight  float64    `json:"total_weight"`
+	ShippingCost float64    `json:"shipping_cost"`
+	Discount     float64    `json:"discount"`
+	Total        float64    `json:"total"`
+}
+
+// CartLine is one cart item priced at the live product price. The *Changed flags
+// compare the live product with the snapshot taken when the item was added.
+type CartLine struct {
+	CartItemID        uint    `json:"cart_item_id"`
+	ProductID         uint    `json:"product_id"`
+	ProductEName      string  `json:"product_ename"`
+	ProductArName     string  `json:"product_arname"`
+	ProductImage      string  `json:"product_image"`
+	Quantity          int     `json:"quantity"`
+	UnitPrice         float64 `json:"unit_price"`
+	RegularPrice      float64 `json:"regular_price"`
+	LineTotal         float64 `json:"line_total"`
+	Savings           float64 `json:"savings"` // markdown from the regular price
+	Weight            float64 `json:"weight"`
+	AvailableStock    int     `json:"available_stock"`
+	SnapshotPrice     float64 `json:"snapshot_price"`
+	PriceChanged      bool    `json:"price_changed"`
+	StockChanged      bool    `json:"stock_changed"`
+	InsufficientStock bool    `json:"insufficient_stock"`
+	Unavailable       bool    `json:"unavailable"` // product was deleted
+}
+
+// CartSummary is the authoritative price of a cart, using the same rules as PlaceOrder.
+type CartSummary struct {
+	Items        []CartLine   `json:"items"`
+	Subtotal     float64      `json:"subtotal"`
+	Savings      float64      `json:"savings"`
+	TotalWeight  float64      `json:"total_weight"`
+	ShippingCost float64      `json:"shipping_cost"`
+	FreeShipping bool         `json:"free_shipping"`
+	CouponCode   string       `json:"coupon_code,omitempty"`
+	CouponError  string       `json:"coupon_error,omitempty"` // why the applied coupon gives no discount
+	Discount     float64      `json:"discount"`
+	Total        float64      `json:"total"`
+	CanCheckout  bool         `json:"can_checkout"` // false while any line is unavailable or short on stock
+	Changes      []CartChange `json:"changes"`      // adjustments made when the cart was refreshed
+}
+
+// MarkChanges flags the lines a cart refresh adjusted, since their snapshots
+// now match the live product.
+func (s *CartSummary) MarkChanges(changes []CartChange) {
+	s.Changes = changes
+	for i := range s.Items {
+		line := &s.Items[i]
+		for _, change := range changes {
+			if change.ProductID != line.ProductID {
+				continue
+			}
+			switch change.Type {
+			case CartItemPriceChanged:
+				line.PriceChanged = true
+				line.SnapshotPrice = change.OldPrice
+			case CartItemQuantityReduced:
+				line.StockChanged = true
+			}
+		}
+	}
+}
+
+// CalculateShipping returns the default shipping cost for the given total weight,
+// used when no shipping rule matches the destination.
+func CalculateShipping(totalWeight float64) float64 {
+	if totalWeight <= 0 {
+		return 0.0
+	} else if totalWeight <= 29 {
+		return 30.0
+	} else if totalWeight <= 59 {
+		return 60.0
+	} else if totalWeight <= 89 {
+		return 90.0
+	}
+	extraBlocks := int(math.Ceil((totalWeight - 89) / 30.0))
+	return 90.0 + float64(extraBlocks*30)
+}
+
+// SummarizeCart prices cart.Items from the live products table, quotes shipping
+// to dest and applies the cart's coupon. Unavailable and short-stocked lines are
+// flagged rather than rejected, and left out of the totals.
+func SummarizeCart(db *gorm.DB, cart models.Cart, dest models.Address) (CartSummary, error) {
+	summary := CartSummary{Items: []CartLine{}, CanCheckout: len(cart.Items) > 0, Changes: []CartChange{}}
+
+	for _, item := range cart.Items {
+		line := CartLine{
+			CartItemID:    item.ID,
+			ProductID:     item.ProductID,
+			ProductEName:  item.ProductEName,
+			ProductArName: item.ProductArName,
+			ProductImage:  item.ProductImage,
+			Quantity:      item.Quantity,
+			SnapshotPrice: item.ProductSalePrice,
+		}
+
+		var product models.Product
+		if err := db.First(&product, "id = ?", item.ProductID).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return summary, err
+			}
+			line.Unavailable = true
+			summary.CanCheckout = false
+			summary.Items = append(summary.Items, line)
+			continue
+		}
+
+		available, err := AvailableStock(db, product, item.CartID)
+		if err != nil {
+			return summary, err
+		}
+		price, _, err := models.EffectivePrice(db, product)
+		if err != nil {
+			return summary, err
+		}
+
+		line.ProductEName = product.EName
+		line.ProductArName = product.ARName
+		line.ProductImage = product.Image
+		line.UnitPrice = price
+		line.RegularPrice = product.RegularPrice
+		line.LineTotal = RoundMoney(price * float64(item.Quantity))
+		if product.RegularPrice > price {
+			line.Savings = RoundMoney((product.RegularPrice - price) * float64(item.Quantity))
+		}
+		line.Weight = product.Weight * float64(item.Quantity)
+		line.AvailableStock = available
+		line.PriceChanged = RoundMoney(price) != RoundMoney(item.ProductSalePrice)
+		line.StockChanged = product.Stock != item.ProductStock
+		line.InsufficientStock = available < item.Quantity
+
+		if line.InsufficientStock {
+			summary.CanCheckout = false
+		} else {
+			summary.Subtotal += line.LineTotal
+			summary.Savings += line.Savings
+			summary.TotalWeight += line.Weight
+		}
+		summary.Items = append(summary.Items, line)
+	}
+
+	summary.Subtotal = RoundMoney(summary.Subtotal)
+	summary.Savings = RoundMoney(summary.Savings)
+
+	quote, err := QuoteShipping(db, dest, summary.TotalWeight, summary.Subtotal)
+	if err != nil {
+		return summary, err
+	}
+	summary.ShippingCost = quote.Cost
+	summary.FreeShipping = quote.FreeShipping
+
+	if cart.CouponCode != "" {
+		summary.CouponCode = cart.CouponCode
+		discount, err := summary.couponDiscount(db, cart)
+		switch {
+		case errors.Is(err, ErrCouponNotApplicable):
+			summary.CouponError = err.Error()
+		case err != nil:
+			return summary, err
+		default:
+			summary.Discount = discount
+		}
+	}
+
+	summary.Total = RoundMoney(summary.Subtotal + summary.ShippingCost - summary.Discount)
+	return summary, nil
+}
+
+// couponDiscount prices the cart's coupon against the summarized lines
+func (s *CartSummary) couponDiscount(db *gorm.DB, cart models.Cart) (float64, error) {
+	coupon, err := FindCoupon(db, cart.CouponCode)
+	if err != nil {
+		return 0, err
+	}
+
+	var lines []CouponLine
+	for _, line := range s.Items {
+		if !line.Unavailable && !line.InsufficientStock {
+			lines = append(lines, CouponLine{ProductID: line.ProductID, Amount: line.LineTotal})
+		}
+	}
+	return CouponDiscount(db, coupon, cart.UserID, lines, s.Subtotal, s.ShippingCost)
+}
+
+// PriceCart reprices cart.Items against the current products table, quotes
+// shipping to dest and applies the cart's coupon.
+// Deleted products, items exceeding available stock (net of other carts'
+// reservations) and coupons that no longer apply are rejected.
+func PriceCart(db *gorm.DB, cart models.Cart, dest models.Address) (CartTotals, error) {
+	var totals CartTotals
+	if len(cart.Items) == 0 {
+		return totals, errors.New("cart is empty")
+	}
+
+	summary, err := SummarizeCart(db, cart, dest)
+	if err != nil {
+		return totals, err
+	}
+	if summary.CouponError != "" {
+		return totals, errors.New(summary.CouponError)
+	}
+	for _, line := range summary.Items {
+		if line.Unavailable {
+			return totals, errors.New("product no longer available: " + line.ProductEName)
+		}
+		if line.InsufficientStock {
+			return totals, errors.New("insufficient stock for product: " + line.ProductEName)
+		}
+	}
+
+	totals.Items = summary.Items
+	totals.Subtotal = summary.Subtotal
+	totals.TotalWeight = summary.TotalWeight
+	totals.ShippingCost = summary.ShippingCost
+	totals.Discount = summary.Discount
+	totals.Total = summary.Total
+	return totals, nil
+}
+
+// RoundMoney rounds an amount to two decimal places.
+func RoundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,184 @@
+package orderControllers
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCheckoutInProgress rejects cart changes while the cart's payment is in flight
+var ErrCheckoutInProgress = errors.New("payment in progress for this cart, try again once it completes")
+
+// ReservationTTL is how long checkout holds stock for a payment.
+// It should outlive the gateway's payment page; set STOCK_RESERVATION_TTL to override.
+func ReservationTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("STOCK_RESERVATION_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 30 * time.Minute
+}
+
+// CheckCartEditable returns ErrCheckoutInProgress while a payment session opened
+// for the cart within the reservation TTL is still pending.
+func CheckCartEditable(db *gorm.DB, cartID uint) error {
+	var count int64
+	if err := db.Model(&models.PaymentSession{}).
+		Where("cart_id = ? AND status = ? AND created_at > ?",
+			cartID, models.PaymentSessionPending, time.Now().Add(-ReservationTTL())).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCheckoutInProgress
+	}
+	return nil
+}
+
+// CheckNoPendingPayment returns ErrCheckoutInProgress while any payment session for
+// the cart may still be paid: pending, and young enough that its reservations hold.
+// Checkout calls it with the cart row locked, so a cart has one open payment at most.
+func CheckNoPendingPayment(db *gorm.DB, cartID uint) error {
+	var count int64
+	if err := db.Model(&models.PaymentSession{}).
+		Where("cart_id = ? AND status = ? AND created_at > ?",
+			cartID, models.PaymentSessionPending, time.Now().Add(-ReservationTTL()-maxPendingHold)).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCheckoutInProgress
+	}
+	return nil
+}
+
+// maxPendingHold caps how long a reservation outlives its TTL while its payment
+// is still pending at the gateway, in case the session is never resolved
+const maxPendingHold = 24 * time.Hour
+
+// liveReservationSQL matches active reservations that still hold stock: within
+// their TTL, or past it while their payment session is still pending, so a late
+// webhook or reconciler settlement still finds the stock it was promised.
+const liveReservationSQL = `stock_reservations.status = ? AND (
+	stock_reservations.expires_at > ? OR (
+		stock_reservations.expires_at > ? AND EXISTS (
+			SELECT 1 FROM payment_sessions ps
+			WHERE ps.id = stock_reservations.payment_session_id AND ps.status = ?
+		)
+	)
+)`
+
+// liveReservations scopes a query to reservations that still hold stock
+func liveReservations(db *gorm.DB) *gorm.DB {
+	now := time.Now()
+	return db.Model(&models.StockReservation{}).Where(liveReservationSQL,
+		models.StockReservationActive, now, now.Add(-maxPendingHold), models.PaymentSessionPending)
+}
+
+// ReservedStock returns the units of a product held by other carts' live reservations
+func ReservedStock(db *gorm.DB, productID, excludeCartID uint) (int, error) {
+	var reserved int
+	err := liveReservations(db).
+		Where("product_id = ? AND cart_id <> ?", productID, excludeCartID).
+		Select("COALESCE(SUM(quantity), 0)").Scan(&reserved).Error
+	return reserved, err
+}
+
+// AvailableStock is the product's stock minus what other carts have reserved
+func AvailableStock(db *gorm.DB, product models.Product, cartID uint) (int, error) {
+	reserved, err := ReservedStock(db, product.ID, cartID)
+	if err != nil {
+		return 0, err
+	}
+	return product.Stock - reserved, nil
+}
+
+// ReserveCartStock holds the cart's items for a payment session until ttl passes.
+// Reservations from the cart's earlier checkouts are released first.
+func ReserveCartStock(tx *gorm.DB, cartID, sessionID uint, items []models.CartItem, ttl time.Duration) error {
+	if err := tx.Model(&models.StockReservation{}).
+		Where("cart_id = ? AND status = ?", cartID, models.StockReservationActive).
+		Update("status", models.StockReservationReleased).Error; err != nil {
+		return err
+	}
+
+	quantities := make(map[uint]int)
+	var productIDs []uint
+	for _, item := range items {
+		if _, ok := quantities[item.ProductID]; !ok {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+	// Lock products in a fixed order so concurrent checkouts can't deadlock
+	sort.Slice(productIDs, func(i, j int) bool { return productIDs[i] < productIDs[j] })
+
+	expiresAt := time.Now().Add(ttl)
+	for _, productID := range productIDs {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, "id = ?", productID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("product no longer available")
+			}
+			return err
+		}
+
+		available, err := AvailableStock(tx, product, cartID)
+		if err != nil {
+			return err
+		}
+		if available < quantities[productID] {
+			return errors.New("insufficient stock for product: " + product.EName)
+		}
+
+		if err := tx.Create(&models.StockReservation{
+			CartID:           cartID,
+			PaymentSessionID: sessionID,
+			ProductID:        productID,
+			Quantity:         quantities[productID],
+			Status:           models.StockReservationActive,
+			ExpiresAt:        expiresAt,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// heldStock returns the units per product held by the live reservations matching
+// query, e.g. "cart_id = ?" or "payment_session_id = ?"
+func heldStock(tx *gorm.DB, query string, id uint) (map[uint]int, error) {
+	var reservations []models.StockReservation
+	if err := liveReservations(tx).Where(query, id).Find(&reservations).Error; err != nil {
+		return nil, err
+	}
+
+	held := make(map[uint]int, len(reservations))
+	for _, r := range reservations {
+		held[r.ProductID] += r.Quantity
+	}
+	return held, nil
+}
+
+// ReleaseSessionReservations frees the stock held for a payment session that won't complete
+func ReleaseSessionReservations(db *gorm.DB, sessionID uint) error {
+	return db.Model(&models.StockReservation{}).
+		Where("payment_session_id = ? AND status = ?", sessionID, models.StockReservationActive).
+		Update("status", models.StockReservationReleased).Error
+}
+
+// ReleaseExpiredReservations marks reservations past their TTL as released,
+// unless their payment is still pending at the gateway
+func ReleaseExpiredReservations(db *gorm.DB) (int64, error) {
+	now := time.Now()
+	result := db.Model(&models.StockReservation{}).
+		Where("status = ?", models.StockReservationActive).
+		Where("NOT ("+liveReservationSQL+")",
+			models.StockReservationActive, now, now.Add(-maxPendingHold), models.PaymentSessionPending).
+		Update("status", models.StockReservationReleased)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,184 @@
+package orderControllers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/junaidrashid-git/ecommerce-api/internal/testdb"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// seedReservationProduct creates a product with 10 units in stock
+func seedReservationProduct(t *testing.T, db *gorm.DB) models.Product {
+	t.Helper()
+	product := models.Product{EName: "Kettle", Image: "/kettle.png", SalePrice: 80, Weight: 1, Stock: 10}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	return product
+}
+
+// seedSession creates a payment session for a cart in the given status
+func seedSession(t *testing.T, db *gorm.DB, cartID uint, status models.PaymentSessionStatus) models.PaymentSession {
+	t.Helper()
+	session := models.PaymentSession{CartID: cartID, UserID: "reservation-test", Status: status, Amount: 1, Currency: "AED"}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	session.Reference = fmt.Sprintf("%d-%d", cartID, session.ID)
+	if err := db.Model(&session).Update("reference", session.Reference).Error; err != nil {
+		t.Fatalf("set session reference: %v", err)
+	}
+	return session
+}
+
+// reserve holds quantity units of a product for a cart's new session
+func reserve(t *testing.T, db *gorm.DB, cartID uint, product models.Product, quantity int) models.PaymentSession {
+	t.Helper()
+	session := seedSession(t, db, cartID, models.PaymentSessionPending)
+	items := []models.CartItem{{CartID: cartID, ProductID: product.ID, Quantity: quantity}}
+	if err := ReserveCartStock(db, cartID, session.ID, items, ReservationTTL()); err != nil {
+		t.Fatalf("reserve %d for cart %d: %v", quantity, cartID, err)
+	}
+	return session
+}
+
+func available(t *testing.T, db *gorm.DB, product models.Product, cartID uint) int {
+	t.Helper()
+	n, err := AvailableStock(db, product, cartID)
+	if err != nil {
+		t.Fatalf("available stock: %v", err)
+	}
+	return n
+}
+
+func reservationStatus(t *testing.T, db *gorm.DB, id uint) models.StockReservationStatus {
+	t.Helper()
+	var r models.StockReservation
+	if err := db.First(&r, id).Error; err != nil {
+		t.Fatalf("load reservation: %v", err)
+	}
+	return r.Status
+}
+
+func TestAvailableStockNetsOutLiveHolds(t *testing.T) {
+	db := testdb.Open(t)
+	product := seedReservationProduct(t, db)
+	reserve(t, db, 1001, product, 3)
+	reserve(t, db, 1002, product, 2)
+
+	if got := available(t, db, product, 1003); got != 5 {
+		t.Errorf("another cart sees %d available, want 5", got)
+	}
+	// A cart's own hold is available to it
+	if got := available(t, db, product, 1001); got != 7 {
+		t.Errorf("holding cart sees %d available, want 7", got)
+	}
+	if reserved, err := ReservedStock(db, product.ID, 0); err != nil || reserved != 5 {
+		t.Errorf("reserved %d, %v; want 5", reserved, err)
+	}
+}
+
+func TestReserveCartStock(t *testing.T) {
+	db := testdb.Open(t)
+	product := seedReservationProduct(t, db)
+	first := reserve(t, db, 1001, product, 8)
+
+	// Only 2 units are left for other carts
+	other := seedSession(t, db, 1002, models.PaymentSessionPending)
+	items := []models.CartItem{{CartID: 1002, ProductID: product.ID, Quantity: 3}}
+	if err := ReserveCartStock(db, 1002, other.ID, items, ReservationTTL()); err == nil {
+		t.Error("reserved 3 units with only 2 free")
+	}
+
+	// Checking out again supersedes the cart's earlier hold instead of adding to it
+	reserve(t, db, 1001, product, 9)
+	var held []models.StockReservation
+	db.Where("cart_id = ? AND status = ?", 1001, models.StockReservationActive).Find(&held)
+	if len(held) != 1 || held[0].Quantity != 9 || held[0].PaymentSessionID == first.ID {
+		t.Errorf("active holds %+v, want only the new 9-unit hold", held)
+	}
+	if got := available(t, db, product, 1002); got != 1 {
+		t.Errorf("another cart sees %d available, want 1", got)
+	}
+}
+
+func TestReservationExpiry(t *testing.T) {
+	db := testdb.Open(t)
+	product := seedReservationProduct(t, db)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		session   models.PaymentSessionStatus
+		expiresAt time.Time
+		wantLive  bool
+	}{
+		{"within TTL", models.PaymentSessionPending, now.Add(time.Minute), true},
+		{"past TTL, payment failed", models.PaymentSessionFailed, now.Add(-time.Minute), false},
+		{"past TTL, payment cancelled", models.PaymentSessionCancelled, now.Add(-time.Minute), false},
+		{"past TTL, payment still pending", models.PaymentSessionPending, now.Add(-time.Hour), true},
+		{"past the pending cap", models.PaymentSessionPending, now.Add(-maxPendingHold - time.Minute), false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cartID := uint(2001 + i)
+			session := seedSession(t, db, cartID, tt.session)
+			hold := models.StockReservation{
+				CartID:           cartID,
+				PaymentSessionID: session.ID,
+				ProductID:        product.ID,
+				Quantity:         4,
+				Status:           models.StockReservationActive,
+				ExpiresAt:        tt.expiresAt,
+			}
+			if err := db.Create(&hold).Error; err != nil {
+				t.Fatalf("create reservation: %v", err)
+			}
+			defer db.Model(&hold).Update("status", models.StockReservationReleased)
+
+			want := 10
+			if tt.wantLive {
+				want = 6
+			}
+			if got := available(t, db, product, 0); got != want {
+				t.Errorf("%d available, want %d", got, want)
+			}
+
+			// The sweeper releases exactly the holds that are no longer live
+			if _, err := ReleaseExpiredReservations(db); err != nil {
+				t.Fatalf("sweep: %v", err)
+			}
+			wantStatus := models.StockReservationReleased
+			if tt.wantLive {
+				wantStatus = models.StockReservationActive
+			}
+			if got := reservationStatus(t, db, hold.ID); got != wantStatus {
+				t.Errorf("after sweep %q, want %q", got, wantStatus)
+			}
+		})
+	}
+}
+
+func TestReleaseSessionReservations(t *testing.T) {
+	db := testdb.Open(t)
+	product := seedReservationProduct(t, db)
+	failed := reserve(t, db, 1001, product, 3)
+	kept := reserve(t, db, 1002, product, 2)
+
+	// The payment failed or was cancelled: only its stock comes back
+	if err := ReleaseSessionReservations(db, failed.ID); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if got := available(t, db, product, 0); got != 8 {
+		t.Errorf("%d available, want 8", got)
+	}
+
+	var statuses []models.StockReservationStatus
+	db.Model(&models.StockReservation{}).Where("payment_session_id = ?", kept.ID).Pluck("status", &statuses)
+	if len(statuses) != 1 || statuses[0] != models.StockReservationActive {
+		t.Errorf("other session's holds %v, want one active", statuses)
+	}
+}
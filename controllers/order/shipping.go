@@ -0,0 +1,225 @@
+package orderControllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// ShippingQuote is the shipping charge for a destination, weight and subtotal
+type ShippingQuote struct {
+	Cost         float64 `json:"cost"`
+	FreeShipping bool    `json:"free_shipping"`
+	RuleID       *uint   `json:"rule_id"` // nil when the default weight tiers were used
+	RuleName     string  `json:"rule_name,omitempty"`
+}
+
+// QuoteShipping prices shipping from the active shipping rules. The most specific
+// destination match wins (city, then country, then any), then the highest priority.
+// Without a matching rule it falls back to the default weight tiers.
+func QuoteShipping(db *gorm.DB, dest models.Address, totalWeight, subtotal float64) (ShippingQuote, error) {
+	if totalWeight <= 0 {
+		return ShippingQuote{}, nil
+	}
+
+	var rules []models.ShippingRule
+	if err := db.Where("active = ?", true).Order("priority DESC, id ASC").Find(&rules).Error; err != nil {
+		return ShippingQuote{}, err
+	}
+
+	var best *models.ShippingRule
+	bestScore := -1
+	for i := range rules {
+		rule := &rules[i]
+		score, ok := matchShippingRule(*rule, dest, totalWeight)
+		if ok && score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+
+	if best == nil {
+		return ShippingQuote{Cost: CalculateShipping(totalWeight)}, nil
+	}
+
+	quote := ShippingQuote{RuleID: &best.ID, RuleName: best.Name}
+	if best.FreeOver > 0 && subtotal >= best.FreeOver {
+		quote.FreeShipping = true
+		return quote, nil
+	}
+
+	quote.Cost = best.Cost
+	if best.StepWeight > 0 && totalWeight > best.MinWeight {
+		steps := math.Ceil((totalWeight - best.MinWeight) / best.StepWeight)
+		quote.Cost += steps * best.StepCost
+	}
+	quote.Cost = RoundMoney(quote.Cost)
+	return quote, nil
+}
+
+// matchShippingRule reports whether a rule covers the destination and weight,
+// and how specific its destination is
+func matchShippingRule(rule models.ShippingRule, dest models.Address, totalWeight float64) (int, bool) {
+	if totalWeight <= rule.MinWeight || (rule.MaxWeight > 0 && totalWeight > rule.MaxWeight) {
+		return 0, false
+	}
+
+	score := 0
+	if rule.Country != "" {
+		if !strings.EqualFold(strings.TrimSpace(rule.Country), strings.TrimSpace(dest.Country)) {
+			return 0, false
+		}
+		score++
+	}
+	if rule.City != "" {
+		if !strings.EqualFold(strings.TrimSpace(rule.City), strings.TrimSpace(dest.City)) {
+			return 0, false
+		}
+		score += 2
+	}
+	return score, true
+}
+
+// UserShippingAddress returns the profile address a user's orders ship to
+func UserShippingAddress(db *gorm.DB, userID string) (models.Address, error) {
+	var user models.User
+	if err := db.Select("id", "country", "state", "city", "street", "postal_code").
+		First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Address{}, nil
+		}
+		return models.Address{}, err
+	}
+	return user.Address, nil
+}
+
+// ShippingQuoteHandler lets the app show the shipping charge checkout will apply.
+// GET /public/shipping/quote?country=AE&city=Dubai&weight=12.5&subtotal=250
+func ShippingQuoteHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		weight, err := strconv.ParseFloat(c.Query("weight"), 64)
+		if err != nil || weight < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid weight"})
+			return
+		}
+
+		var subtotal float64
+		if s := c.Query("subtotal"); s != "" {
+			if subtotal, err = strconv.ParseFloat(s, 64); err != nil || subtotal < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subtotal"})
+				return
+			}
+		}
+
+		dest := models.Address{Country: c.Query("country"), City: c.Query("city")}
+		quote, err := QuoteShipping(db, dest, weight, subtotal)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to quote shipping"})
+			return
+		}
+		c.JSON(http.StatusOK, quote)
+	}
+}
+
+// GetShippingRules lists all shipping rules.
+// GET /admin/shipping-rules
+func GetShippingRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rules []models.ShippingRule
+		if err := db.Order("country, city, min_weight, priority DESC").Find(&rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping rules"})
+			return
+		}
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+// CreateShippingRule adds a shipping rule.
+// POST /admin/shipping-rules
+func CreateShippingRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := models.ShippingRule{Active: true}
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rule.ID = 0
+		if err := validateShippingRule(rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Select("*") so an explicit "active": false isn't replaced by the column default
+		if err := db.Select("*").Create(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shipping rule"})
+			return
+		}
+		c.JSON(http.StatusCreated, rule)
+	}
+}
+
+// UpdateShippingRule replaces a shipping rule.
+// PUT /admin/shipping-rules/:id
+func UpdateShippingRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.ShippingRule
+		if err := db.First(&rule, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shipping rule not found"})
+			return
+		}
+
+		id := rule.ID
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rule.ID = id
+		if err := validateShippingRule(rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := db.Save(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shipping rule"})
+			return
+		}
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// DeleteShippingRule removes a shipping rule.
+// DELETE /admin/shipping-rules/:id
+func DeleteShippingRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := db.Delete(&models.ShippingRule{}, "id = ?", c.Param("id"))
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shipping rule"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shipping rule not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Shipping rule deleted"})
+	}
+}
+
+// validateShippingRule rejects negative amounts and inverted weight bands
+func validateShippingRule(rule models.ShippingRule) error {
+	if rule.MinWeight < 0 || rule.MaxWeight < 0 || rule.Cost < 0 ||
+		rule.StepWeight < 0 || rule.StepCost < 0 || rule.FreeOver < 0 {
+		return errors.New("weights and amounts cannot be negative")
+	}
+	if rule.MaxWeight > 0 && rule.MaxWeight <= rule.MinWeight {
+		return errors.New("max_weight must be greater than min_weight")
+	}
+	if rule.City != "" && rule.Country == "" {
+		return errors.New("city rules need a country")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package orderControllers
+
+import (
+	"testing"
+
+	"github.com/junaidrashid-git/ecommerce-api/internal/testdb"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+)
+
+func TestMatchShippingRule(t *testing.T) {
+	dubai := models.Address{Country: "AE", City: "Dubai"}
+
+	tests := []struct {
+		name      string
+		rule      models.ShippingRule
+		dest      models.Address
+		weight    float64
+		wantScore int
+		wantOK    bool
+	}{
+		{"any destination", models.ShippingRule{}, dubai, 5, 0, true},
+		{"country", models.ShippingRule{Country: "AE"}, dubai, 5, 1, true},
+		{"country ignores case and spaces", models.ShippingRule{Country: " ae "}, dubai, 5, 1, true},
+		{"other country", models.ShippingRule{Country: "OM"}, dubai, 5, 0, false},
+		{"city", models.ShippingRule{Country: "AE", City: "dubai"}, dubai, 5, 3, true},
+		{"city in any country", models.ShippingRule{City: "Dubai"}, dubai, 5, 2, true},
+		{"other city", models.ShippingRule{Country: "AE", City: "Sharjah"}, dubai, 5, 0, false},
+		{"no address", models.ShippingRule{Country: "AE"}, models.Address{}, 5, 0, false},
+		{"above min weight", models.ShippingRule{MinWeight: 10}, dubai, 10.5, 0, true},
+		{"at min weight", models.ShippingRule{MinWeight: 10}, dubai, 10, 0, false},
+		{"at max weight", models.ShippingRule{MaxWeight: 30}, dubai, 30, 0, true},
+		{"above max weight", models.ShippingRule{MaxWeight: 30}, dubai, 30.1, 0, false},
+		{"no upper bound", models.ShippingRule{MinWeight: 30}, dubai, 1000, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, ok := matchShippingRule(tt.rule, tt.dest, tt.weight)
+			if ok != tt.wantOK || (ok && score != tt.wantScore) {
+				t.Errorf("got %d, %v; want %d, %v", score, ok, tt.wantScore, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCalculateShipping(t *testing.T) {
+	tests := []struct {
+		weight float64
+		want   float64
+	}{
+		{0, 0},
+		{1, 30},
+		{29, 30},
+		{29.5, 60},
+		{59, 60},
+		{89, 90},
+		{90, 120},
+		{119, 120},
+		{119.5, 150},
+	}
+	for _, tt := range tests {
+		if got := CalculateShipping(tt.weight); got != tt.want {
+			t.Errorf("CalculateShipping(%v) = %v, want %v", tt.weight, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteShipping(t *testing.T) {
+	db := testdb.Open(t)
+	rules := map[string]*models.ShippingRule{
+		"flat":      {Name: "UAE", Country: "AE", MaxWeight: 30, Cost: 20},
+		"outranked": {Name: "UAE backup", Country: "AE", MaxWeight: 30, Cost: 99, Priority: -1},
+		"city":      {Name: "Dubai", Country: "AE", City: "Dubai", MaxWeight: 30, Cost: 10, FreeOver: 300},
+		"heavy":     {Name: "UAE heavy", Country: "AE", MinWeight: 30, Cost: 50, StepWeight: 10, StepCost: 5},
+		"inactive":  {Name: "UAE old", Country: "AE", Cost: 1, Priority: 10},
+	}
+	for _, rule := range rules {
+		if err := db.Create(rule).Error; err != nil {
+			t.Fatalf("create rule: %v", err)
+		}
+	}
+	// Active defaults to true on create
+	if err := db.Model(rules["inactive"]).Update("active", false).Error; err != nil {
+		t.Fatalf("deactivate rule: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		dest     models.Address
+		weight   float64
+		subtotal float64
+		wantCost float64
+		wantRule string // "" for the default weight tiers
+		wantFree bool
+	}{
+		{"country rule", models.Address{Country: "AE", City: "Sharjah"}, 5, 100, 20, "flat", false},
+		{"at the band's max weight", models.Address{Country: "AE"}, 30, 100, 20, "flat", false},
+		{"city beats country", models.Address{Country: "ae", City: " dubai "}, 5, 100, 10, "city", false},
+		{"free over threshold", models.Address{Country: "AE", City: "Dubai"}, 5, 300, 0, "city", true},
+		{"heavy band with steps", models.Address{Country: "AE"}, 45, 100, 60, "heavy", false},
+		{"no rule falls back to tiers", models.Address{Country: "OM"}, 5, 100, 30, "", false},
+		{"fallback for heavy parcels", models.Address{Country: "OM"}, 100, 100, CalculateShipping(100), "", false},
+		{"nothing to ship", models.Address{Country: "AE"}, 0, 100, 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := QuoteShipping(db, tt.dest, tt.weight, tt.subtotal)
+			if err != nil {
+				t.Fatalf("QuoteShipping: %v", err)
+			}
+			if quote.Cost != tt.wantCost || quote.FreeShipping != tt.wantFree {
+				t.Errorf("got cost %.2f free %v, want %.2f free %v", quote.Cost, quote.FreeShipping, tt.wantCost, tt.wantFree)
+			}
+			switch {
+			case tt.wantRule == "" && quote.RuleID != nil:
+				t.Errorf("used rule %d %q, want the default tiers", *quote.RuleID, quote.RuleName)
+			case tt.wantRule != "" && (quote.RuleID == nil || *quote.RuleID != rules[tt.wantRule].ID):
+				t.Errorf("used rule %v %q, want %q", quote.RuleID, quote.RuleName, rules[tt.wantRule].Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package orderControllers
+
+import (
+	"fmt"
+
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidTransition is returned when a status change is not allowed by the order workflow
+type ErrInvalidTransition struct {
+	From models.OrderStatus
+	To   models.OrderStatus
+}
+
+func (e ErrInvalidTransition) Error() string {
+	return fmt.Sprintf("cannot change order status from %s to %s", e.From, e.To)
+}
+
+// ChangeOrderStatus moves an order to a new status if the workflow allows it
+// and records the change in the order's status history.
+// The order should be locked by the caller's transaction.
+func ChangeOrderStatus(tx *gorm.DB, order *models.Order, to models.OrderStatus, actor, note string) error {
+	if !order.Status.CanTransitionTo(to) {
+		return ErrInvalidTransition{From: order.Status, To: to}
+	}
+
+	history := models.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   to,
+		Actor:      actor,
+		Note:       note,
+	}
+	if err := tx.Model(order).Update("status", to).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return err
+	}
+
+	order.Status = to
+	order.StatusHistory = append(order.StatusHistory, history)
+	return nil
+}
+
+// preloadStatusHistory loads an order's status history oldest first
+func preloadStatusHistory(db *gorm.DB) *gorm.DB {
+	return db.Order("created_at ASC, id ASC")
+}
@@ -0,0 +1,92 @@
+package orderControllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidRestock is returned when a restock request doesn't match the order's items
+var ErrInvalidRestock = errors.New("invalid restock request")
+
+// RestockLine puts part of an order line back on sale
+type RestockLine struct {
+	OrderItemID uint `json:"order_item_id" binding:"required"`
+	Quantity    int  `json:"quantity" binding:"min=0"`
+}
+
+// RestockOrder returns units from an order to product stock and records how many
+// were restocked per line, so an item is never restocked twice.
+// A nil lines restocks everything not yet restocked; otherwise only the listed
+// quantities go back (e.g. damaged returns are left out).
+// Each restocked line is written to the stock ledger under reason, by actor.
+// order.Items must be loaded and the order locked by the caller's transaction.
+func RestockOrder(tx *gorm.DB, order *models.Order, lines []RestockLine, reason models.StockMovementReason, actor string) error {
+	quantities := make(map[uint]int, len(order.Items))
+	if lines == nil {
+		for _, item := range order.Items {
+			quantities[item.ID] = item.Quantity - item.RestockedQuantity
+		}
+	} else {
+		known := make(map[uint]models.OrderItem, len(order.Items))
+		for _, item := range order.Items {
+			known[item.ID] = item
+		}
+		for _, line := range lines {
+			item, ok := known[line.OrderItemID]
+			if !ok {
+				return fmt.Errorf("%w: order item %d does not belong to this order", ErrInvalidRestock, line.OrderItemID)
+			}
+			quantities[item.ID] += line.Quantity
+			if quantities[item.ID] > item.Quantity-item.RestockedQuantity {
+				return fmt.Errorf("%w: only %d of %s can be restocked",
+					ErrInvalidRestock, item.Quantity-item.RestockedQuantity, item.ProductEName)
+			}
+		}
+	}
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		qty := quantities[item.ID]
+		if qty <= 0 {
+			continue
+		}
+
+		// Restock even if the product was soft-deleted since, so its numbers stay right
+		var product models.Product
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, "id = ?", item.ProductID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+
+		if err := tx.Unscoped().Model(&product).Update("stock", gorm.Expr("stock + ?", qty)).Error; err != nil {
+			return err
+		}
+		if err := models.RecordStockMovement(tx, product.ID, qty, product.Stock+qty, reason,
+			strconv.FormatUint(uint64(order.ID), 10), actor); err != nil {
+			return err
+		}
+
+		item.RestockedQuantity += qty
+		if err := tx.Model(item).Update("restocked_quantity", item.RestockedQuantity).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// holdsWarehouseStock reports whether an order's goods are still in the warehouse,
+// i.e. deleting the order should put them back on sale
+func holdsWarehouseStock(status models.OrderStatus) bool {
+	switch status {
+	case models.OrderStatusPending, models.OrderStatusConfirmed, models.OrderStatusReadyToShip:
+		return true
+	}
+	return false
+}
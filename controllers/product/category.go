@@ -1,10 +1,12 @@
 package productcontroller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,6 +28,21 @@ func CreateCategory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		parentID, _, err := parseCategoryParent(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := models.ValidateCategoryParent(db, 0, parentID); err != nil {
+			respondCategoryParentError(c, err)
+			return
+		}
+		sortOrder, _, err := parseCategorySortOrder(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		var imageURL string
 
 		file, err := c.FormFile("image")
@@ -51,9 +68,11 @@ func CreateCategory(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		category := models.Category{
-			EName:  ename,
-			ARName: arname,
-			Image:  imageURL,
+			EName:     ename,
+			ARName:    arname,
+			Image:     imageURL,
+			ParentID:  parentID,
+			SortOrder: sortOrder,
 		}
 
 		if err := db.Create(&category).Error; err != nil {
@@ -65,39 +84,58 @@ func CreateCategory(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func GetAllCategoriesWithProducts(db *gorm.DB) gin.HandlerFunc {
+// GetCategoryTree returns the category tree with product counts and cover
+// images. Products in a category are listed, paginated, through
+// /public/products?category_id=<id>.
+func GetCategoryTree(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var categories []models.Category
+		if err := db.Find(&categories).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+			return
+		}
 
-		// Preload Products
-		if err := db.Preload("Products").Find(&categories).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories with products"})
+		if err := models.ApplyCategoryStats(db, categories); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count category products"})
 			return
 		}
 
-		c.JSON(http.StatusOK, categories)
+		// Nest subcategories under their parents
+		c.JSON(http.StatusOK, models.BuildCategoryTree(categories))
 	}
 }
 
+// GetCategoryByID returns a category and its direct subcategories with product
+// counts and cover images. Its products are listed, paginated, through
+// /public/products?category_id=<id>.
 func GetCategoryByID(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
 		var category models.Category
-		if err := db.Preload("Products").First(&category, id).Error; err != nil {
+		if err := db.Preload("Children", func(db *gorm.DB) *gorm.DB { return db.Order("sort_order, e_name") }).
+			First(&category, id).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
 			return
 		}
 
+		categories := append([]models.Category{category}, category.Children...)
+		if err := models.ApplyCategoryStats(db, categories); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count category products"})
+			return
+		}
+		category = categories[0]
+		category.Children = categories[1:]
+
 		c.JSON(http.StatusOK, category)
 	}
 }
 
-// GetAllCategories returns all categories.
+// GetAllCategories returns all categories as a flat list, in sibling order.
 func GetAllCategories(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var categories []models.Category
-		if err := db.Find(&categories).Error; err != nil {
+		if err := db.Order("parent_id NULLS FIRST, sort_order, e_name").Find(&categories).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
 			return
 		}
@@ -126,6 +164,26 @@ func UpdateCategory(db *gorm.DB) gin.HandlerFunc {
 			category.ARName = v
 		}
 
+		// Move the category, with its subtree, under a new parent
+		parentID, moved, err := parseCategoryParent(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if moved {
+			if err := models.ValidateCategoryParent(db, category.ID, parentID); err != nil {
+				respondCategoryParentError(c, err)
+				return
+			}
+			category.ParentID = parentID
+		}
+		if sortOrder, ok, err := parseCategorySortOrder(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if ok {
+			category.SortOrder = sortOrder
+		}
+
 		file, err := c.FormFile("image")
 		if err == nil {
 			if err := os.MkdirAll(categoryUploadDir, os.ModePerm); err != nil {
@@ -171,7 +229,7 @@ func DeleteCategory(db *gorm.DB) gin.HandlerFunc {
 		id := c.Param("id")
 
 		var cat models.Category
-		if err := db.Preload("Products").First(&cat, id).Error; err != nil {
+		if err := db.First(&cat, id).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
 			return
 		}
@@ -182,6 +240,25 @@ func DeleteCategory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// A coupon scoped to this category would apply store-wide without it
+		var couponCodes []string
+		if err := tx.Table("coupons").
+			Joins("JOIN coupon_categories ON coupon_categories.coupon_id = coupons.id").
+			Where("coupon_categories.category_id = ?", cat.ID).
+			Order("coupons.code").Pluck("coupons.code", &couponCodes).Error; err != nil {
+			tx.Rollback()
+			c.JSON(500, gin.H{"error": "Failed to check coupons"})
+			return
+		}
+		if len(couponCodes) > 0 {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Category is used by coupons, remove it from them first",
+				"coupons": couponCodes,
+			})
+			return
+		}
+
 		// Clear product associations
 		if err := tx.Model(&cat).Association("Products").Clear(); err != nil {
 			tx.Rollback()
@@ -189,6 +266,21 @@ func DeleteCategory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Sales on the category have nothing left to cover
+		if err := tx.Where("category_id = ?", cat.ID).Delete(&models.PriceSchedule{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(500, gin.H{"error": "Failed to delete category price schedules"})
+			return
+		}
+
+		// Move subcategories up to the deleted category's parent so none are orphaned
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", cat.ID).
+			Update("parent_id", cat.ParentID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(500, gin.H{"error": "Failed to move subcategories"})
+			return
+		}
+
 		// 🔥 Delete image file
 		if cat.Image != "" {
 			imagePath := filepath.Join(
@@ -212,3 +304,40 @@ func DeleteCategory(db *gorm.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
 	}
 }
+
+// parseCategoryParent reads the parent_id form field. An empty value or 0 means
+// a top-level category; set reports whether the field was sent at all.
+func parseCategoryParent(c *gin.Context) (parentID *uint, set bool, err error) {
+	v, set := c.GetPostForm("parent_id")
+	if !set || v == "" || v == "0" {
+		return nil, set, nil
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return nil, set, errors.New("Invalid parent_id")
+	}
+	pid := uint(id)
+	return &pid, set, nil
+}
+
+// parseCategorySortOrder reads the sort_order form field, if sent
+func parseCategorySortOrder(c *gin.Context) (int, bool, error) {
+	v, set := c.GetPostForm("sort_order")
+	if !set || v == "" {
+		return 0, false, nil
+	}
+	order, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, true, errors.New("Invalid sort_order")
+	}
+	return order, true, nil
+}
+
+func respondCategoryParentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrCategoryParentNotFound), errors.Is(err, models.ErrCategoryCycle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate parent category"})
+	}
+}
@@ -1,14 +1,17 @@
 package productcontroller
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/middleware"
 	"github.com/junaidrashid-git/ecommerce-api/models"
 	"github.com/tealeg/xlsx"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func ImportProductsFromExcel(db *gorm.DB) gin.HandlerFunc {
@@ -39,6 +42,7 @@ func ImportProductsFromExcel(db *gorm.DB) gin.HandlerFunc {
 
 		sheet := xlFile.Sheets[0]
 		createdCount, updatedCount, skippedCount := 0, 0, 0
+		actor := middleware.Actor(c)
 
 		for i := 1; i < sheet.MaxRow; i++ {
 			row := sheet.Rows[i]
@@ -95,8 +99,14 @@ func ImportProductsFromExcel(db *gorm.DB) gin.HandlerFunc {
 
 			if idStr != "" {
 				if id, err := strconv.Atoi(idStr); err == nil {
-					var existing models.Product
-					if err := db.Preload("Categories").First(&existing, id).Error; err == nil {
+					err := db.Transaction(func(tx *gorm.DB) error {
+						// Lock the row so sales during the import aren't overwritten,
+						// and the ledger records the change from the current stock
+						var existing models.Product
+						if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&existing, id).Error; err != nil {
+							return err
+						}
+						previousStock := existing.Stock
 						existing.EName = product.EName
 						existing.ARName = product.ARName
 						existing.EDescription = product.EDescription
@@ -109,21 +119,35 @@ func ImportProductsFromExcel(db *gorm.DB) gin.HandlerFunc {
 						existing.Image = product.Image
 
 						// Replace categories
-						if err := db.Model(&existing).Association("Categories").Replace(categories); err != nil {
-							skippedCount++
-							continue
+						if err := tx.Model(&existing).Association("Categories").Replace(categories); err != nil {
+							return err
 						}
-
-						if err := db.Save(&existing).Error; err == nil {
-							updatedCount++
-							continue
+						if err := tx.Save(&existing).Error; err != nil {
+							return err
 						}
+						return models.RecordStockMovement(tx, existing.ID, existing.Stock-previousStock, existing.Stock,
+							models.StockMovementImport, excelFileHeader.Filename, actor)
+					})
+					if err == nil {
+						updatedCount++
+						continue
+					}
+					if !errors.Is(err, gorm.ErrRecordNotFound) {
+						skippedCount++
+						continue
 					}
 				}
 			}
 
 			// Insert new product
-			if err := db.Create(&product).Error; err == nil {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&product).Error; err != nil {
+					return err
+				}
+				return models.RecordStockMovement(tx, product.ID, product.Stock, product.Stock,
+					models.StockMovementImport, excelFileHeader.Filename, actor)
+			})
+			if err == nil {
 				createdCount++
 			} else {
 				skippedCount++
@@ -19,22 +19,15 @@ func ExportProductsToExcel(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		file := xlsx.NewFile()
-		sheet, err := file.AddSheet("Products")
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Excel sheet"})
-			return
-		}
-
 		// Header row
-		headers := []string{
+		file, sheet, err := newExcelSheet("Products", []string{
 			"ID", "EName", "ARName", "EDescription", "ARDescription",
 			"SalePrice", "RegularPrice", "BaseCost", "Weight", "Stock",
 			"Image", "CategoryIDs", "CreatedAt", "UpdatedAt",
-		}
-		headerRow := sheet.AddRow()
-		for _, h := range headers {
-			headerRow.AddCell().SetValue(h)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Excel sheet"})
+			return
 		}
 
 		// Data rows
@@ -63,16 +56,36 @@ func ExportProductsToExcel(db *gorm.DB) gin.HandlerFunc {
 			row.AddCell().SetValue(p.UpdatedAt.Format("2006-01-02 15:04:05"))
 		}
 
-		// Set response headers for download
-		c.Header("Content-Disposition", "attachment; filename=products.xlsx")
-		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-		c.Header("Content-Transfer-Encoding", "binary")
-		c.Header("Expires", "0")
+		writeExcelResponse(c, file, "products.xlsx")
+	}
+}
 
-		// Write file to response
-		if err := file.Write(c.Writer); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write Excel file"})
-			return
-		}
+// newExcelSheet creates a workbook with a single sheet and its header row
+func newExcelSheet(name string, headers []string) (*xlsx.File, *xlsx.Sheet, error) {
+	file := xlsx.NewFile()
+	sheet, err := file.AddSheet(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headerRow := sheet.AddRow()
+	for _, h := range headers {
+		headerRow.AddCell().SetValue(h)
+	}
+	return file, sheet, nil
+}
+
+// writeExcelResponse sends the workbook as a file download
+func writeExcelResponse(c *gin.Context, file *xlsx.File, filename string) {
+	// Set response headers for download
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Transfer-Encoding", "binary")
+	c.Header("Expires", "0")
+
+	// Write file to response
+	if err := file.Write(c.Writer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write Excel file"})
+		return
 	}
 }
@@ -0,0 +1,132 @@
+package productcontroller
+
+import (
+	"math"
+
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// priceBucketTarget is roughly how many price ranges the price facet is split into
+const priceBucketTarget = 5
+
+// ProductFacets summarises the products matching a listing for filter sidebars.
+// Each facet ignores its own filter so the other choices stay visible:
+// category counts ignore category_id, price buckets ignore min/max_price and
+// stock counts ignore in_stock.
+type ProductFacets struct {
+	Categories   []CategoryFacet `json:"categories"`
+	PriceBuckets []PriceBucket   `json:"price_buckets"`
+	Stock        StockFacet      `json:"stock"`
+}
+
+type CategoryFacet struct {
+	ID     uint   `json:"id"`
+	EName  string `json:"e_name"`
+	ARName string `json:"ar_name"`
+	Count  int64  `json:"count"`
+}
+
+// PriceBucket counts products priced from Min up to, but not including, Max
+type PriceBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+type StockFacet struct {
+	InStock    int64 `json:"in_stock"`
+	OutOfStock int64 `json:"out_of_stock"`
+}
+
+// productFacets computes the facets for a listing with the given filters
+func productFacets(db *gorm.DB, f productFilters) (ProductFacets, error) {
+	facets := ProductFacets{
+		Categories:   []CategoryFacet{},
+		PriceBuckets: []PriceBucket{},
+	}
+	base := func(f productFilters) *gorm.DB {
+		query, _ := f.apply(db.Model(&models.Product{}))
+		return query
+	}
+
+	// Categories
+	withoutCategories := f
+	withoutCategories.CategoryIDs = nil
+	if err := base(withoutCategories).
+		Select("c.id, c.e_name, c.ar_name, COUNT(DISTINCT products.id) AS count").
+		Joins("JOIN product_categories pc ON pc.product_id = products.id").
+		Joins("JOIN categories c ON c.id = pc.category_id").
+		Group("c.id, c.e_name, c.ar_name").
+		Order("count DESC, c.e_name").
+		Scan(&facets.Categories).Error; err != nil {
+		return facets, err
+	}
+
+	// Price buckets
+	withoutPrice := f
+	withoutPrice.MinPrice, withoutPrice.MaxPrice = nil, nil
+	var bounds struct {
+		Min *float64
+		Max *float64
+	}
+	if err := base(withoutPrice).
+		Select("MIN(" + f.PriceSQL + ") AS min, MAX(" + f.PriceSQL + ") AS max").
+		Scan(&bounds).Error; err != nil {
+		return facets, err
+	}
+	if bounds.Min != nil && bounds.Max != nil {
+		width := priceBucketWidth(*bounds.Min, *bounds.Max)
+		var rows []struct {
+			Bucket int64
+			Count  int64
+		}
+		if err := base(withoutPrice).
+			Select("FLOOR("+f.PriceSQL+" / ?)::bigint AS bucket, COUNT(*) AS count", width).
+			Group("bucket").
+			Order("bucket").
+			Scan(&rows).Error; err != nil {
+			return facets, err
+		}
+		for _, row := range rows {
+			facets.PriceBuckets = append(facets.PriceBuckets, PriceBucket{
+				Min:   roundPrice(float64(row.Bucket) * width),
+				Max:   roundPrice(float64(row.Bucket+1) * width),
+				Count: row.Count,
+			})
+		}
+	}
+
+	// Stock
+	withoutStock := f
+	withoutStock.InStock = false
+	if err := base(withoutStock).
+		Select(`COUNT(*) FILTER (WHERE products.stock > 0) AS in_stock,
+			COUNT(*) FILTER (WHERE products.stock <= 0) AS out_of_stock`).
+		Scan(&facets.Stock).Error; err != nil {
+		return facets, err
+	}
+
+	return facets, nil
+}
+
+// priceBucketWidth picks a round bucket width (1, 2 or 5 times a power of ten)
+// splitting lowest..highest into about priceBucketTarget ranges
+func priceBucketWidth(lowest, highest float64) float64 {
+	raw := (highest - lowest) / priceBucketTarget
+	if raw <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, step := range []float64{1, 2, 5} {
+		if raw <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// roundPrice rounds to two decimals, hiding float error in bucket bounds
+func roundPrice(v float64) float64 {
+	return math.Round(v*100) / 100
+}
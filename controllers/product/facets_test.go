@@ -0,0 +1,39 @@
+package productcontroller
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPriceBucketWidth(t *testing.T) {
+	tests := []struct {
+		name            string
+		lowest, highest float64
+		want            float64
+	}{
+		{"single product", 49.99, 49.99, 1},
+		{"all free", 0, 0, 1},
+		{"inverted range", 100, 10, 1},
+		{"exact step", 0, 5, 1},
+		{"rounds up to 2", 0, 6, 2},
+		{"rounds up to 5", 0, 20, 5},
+		{"rounds up to 10", 0, 30, 10},
+		{"power of ten", 0, 50, 10},
+		{"offset range", 10, 260, 50},
+		{"cheap items", 0.5, 1.5, 0.2},
+		{"pennies", 1.00, 1.03, 0.01},
+		{"typical catalog", 9.99, 1299, 500},
+		{"large range", 0, 1000000, 200000},
+		{"just under a power of ten", 0, 49999.99, 10000},
+	}
+	for _, tt := range tests {
+		got := priceBucketWidth(tt.lowest, tt.highest)
+		if math.Abs(got-tt.want) > 1e-9*math.Max(1, tt.want) {
+			t.Errorf("%s: priceBucketWidth(%v, %v) = %v, want %v", tt.name, tt.lowest, tt.highest, got, tt.want)
+		}
+		// The range always fits in about priceBucketTarget buckets
+		if span := tt.highest - tt.lowest; span > 0 && span/got > priceBucketTarget+1e-9 {
+			t.Errorf("%s: width %v splits %v into %.1f buckets", tt.name, got, span, span/got)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package productcontroller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// productFilters are the product listing filters read from the query string
+type productFilters struct {
+	Search      string
+	CategoryIDs []uint
+	MinPrice    *float64
+	MaxPrice    *float64
+	MinWeight   *float64
+	MaxWeight   *float64
+	InStock     bool
+	OnSale      bool
+	// PriceSQL is the price min/max_price and the price facet compare,
+	// products.sale_price unless the listing shows effective prices
+	PriceSQL string
+}
+
+// parseProductFilters reads the listing filters. category_id may be repeated
+// or comma separated to match products in any of the categories or their subcategories.
+func parseProductFilters(c *gin.Context) (productFilters, error) {
+	f := productFilters{Search: strings.TrimSpace(c.Query("search")), PriceSQL: "products.sale_price"}
+
+	for _, raw := range c.QueryArray("category_id") {
+		for _, part := range strings.Split(raw, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			cid, err := strconv.ParseUint(part, 10, 64)
+			if err != nil {
+				return f, errors.New("Invalid category_id")
+			}
+			f.CategoryIDs = append(f.CategoryIDs, uint(cid))
+		}
+	}
+
+	floats := []struct {
+		param string
+		dest  **float64
+	}{
+		{"min_price", &f.MinPrice},
+		{"max_price", &f.MaxPrice},
+		{"min_weight", &f.MinWeight},
+		{"max_weight", &f.MaxWeight},
+	}
+	for _, fl := range floats {
+		raw := c.Query(fl.param)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 {
+			return f, errors.New("Invalid " + fl.param)
+		}
+		*fl.dest = &v
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		return f, errors.New("min_price cannot be greater than max_price")
+	}
+	if f.MinWeight != nil && f.MaxWeight != nil && *f.MinWeight > *f.MaxWeight {
+		return f, errors.New("min_weight cannot be greater than max_weight")
+	}
+
+	bools := []struct {
+		param string
+		dest  *bool
+	}{
+		{"in_stock", &f.InStock},
+		{"on_sale", &f.OnSale},
+	}
+	for _, b := range bools {
+		raw := c.Query(b.param)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return f, errors.New("Invalid " + b.param)
+		}
+		*b.dest = v
+	}
+	return f, nil
+}
+
+// apply narrows a product query to the filters. It returns the search
+// relevance expression when the search is ranked, nil otherwise.
+func (f productFilters) apply(query *gorm.DB) (*gorm.DB, *clause.Expr) {
+	var rank *clause.Expr
+	if f.Search != "" {
+		query, rank = applySearch(query, f.Search)
+	}
+
+	if f.MinPrice != nil {
+		query = query.Where(f.PriceSQL+" >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		query = query.Where(f.PriceSQL+" <= ?", *f.MaxPrice)
+	}
+	if f.MinWeight != nil {
+		query = query.Where("products.weight >= ?", *f.MinWeight)
+	}
+	if f.MaxWeight != nil {
+		query = query.Where("products.weight <= ?", *f.MaxWeight)
+	}
+
+	// Categories match their subcategories too
+	if len(f.CategoryIDs) > 0 {
+		query = query.Where(
+			"products.id IN (SELECT product_id FROM product_categories WHERE category_id IN ("+models.CategoryDescendantsSQL+"))",
+			f.CategoryIDs,
+		)
+	}
+
+	if f.InStock {
+		query = query.Where("products.stock > 0")
+	}
+
+	// On sale: discounted below the regular price, or covered by a running price schedule
+	if f.OnSale {
+		now := time.Now()
+		query = query.Where(`
+			(products.regular_price > 0 AND products.sale_price < products.regular_price)
+			OR EXISTS (
+				SELECT 1 FROM price_schedules ps
+				WHERE ps.starts_at <= ? AND ps.ends_at > ?
+				AND (ps.product_id = products.id OR ps.category_id IN (`+models.ProductCategoryAncestorsSQL+`))
+			)
+		`, now, now)
+	}
+
+	return query, rank
+}
@@ -36,7 +36,14 @@ func GetProductByID(db *gorm.DB) gin.HandlerFunc {
 			}
 			return
 		}
-		c.JSON(http.StatusOK, product)
+
+		// Show the effective price, and the schedule behind it if a sale is running
+		products := []models.Product{product}
+		if err := models.ApplyPriceSchedules(db, products); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply price schedules"})
+			return
+		}
+		c.JSON(http.StatusOK, products[0])
 	}
 }
 
@@ -1,78 +1,108 @@
 package productcontroller
 
 import (
-	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/junaidrashid-git/ecommerce-api/models"
 	"gorm.io/gorm"
 )
 
+// GetProducts lists products for the storefront. Each product carries its
+// EffectivePrice, including running sales, and prices filter and sort by it.
 func GetProducts(db *gorm.DB) gin.HandlerFunc {
+	return listProducts(db, true)
+}
+
+// GetAdminProducts lists products as stored, without applying price schedules,
+// so the admin form edits the normal sale price
+func GetAdminProducts(db *gorm.DB) gin.HandlerFunc {
+	return listProducts(db, false)
+}
+
+func listProducts(db *gorm.DB, effectivePrices bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 1️⃣ Filtering & sorting params
-		search := c.Query("search")
-		categoryID := c.Query("category_id")
-		minPriceStr := c.Query("min_price")
-		maxPriceStr := c.Query("max_price")
-		sortBy := c.DefaultQuery("sort_by", "created_at")
-		sortOrder := strings.ToLower(c.DefaultQuery("order", "desc"))
-		if sortOrder != "asc" && sortOrder != "desc" {
-			sortOrder = "desc"
+		// 1️⃣ Filtering params
+		filters, err := parseProductFilters(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if effectivePrices {
+			filters.PriceSQL = "(" + models.EffectivePriceSQL + ")"
+		}
+
+		withFacets, err := strconv.ParseBool(c.DefaultQuery("facets", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid facets"})
+			return
 		}
 
-		// 2️⃣ Build base query
-		query := db.Model(&models.Product{}).Preload("Categories")
+		// 2️⃣ Build base query and apply filters, ranked by relevance when searching
+		query, rank := filters.apply(db.Model(&models.Product{}).Preload("Categories"))
 
-		// 3️⃣ Apply search filter
-		if search != "" {
-			likePattern := "%" + search + "%"
-			query = query.Where(`
-				e_name ILIKE ? OR e_description ILIKE ? OR ar_name ILIKE ? OR ar_description ILIKE ?
-			`, likePattern, likePattern, likePattern, likePattern)
+		// 3️⃣ Sorting, limited to whitelisted fields
+		sortKeys, err := parseSort(c.Query("sort_by"), c.Query("order"), rank != nil)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
+		sortBy := sortSpec(sortKeys)
+		sortOrder := sortKeys[0].direction()
 
-		// 4️⃣ Apply price range filter
-		if minPriceStr != "" {
-			if mp, err := strconv.ParseFloat(minPriceStr, 64); err == nil {
-				query = query.Where("sale_price >= ?", mp)
-			} else {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_price"})
-				return
-			}
+		paging, err := parsePagination(c, sortBy)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-		if maxPriceStr != "" {
-			if mp, err := strconv.ParseFloat(maxPriceStr, 64); err == nil {
-				query = query.Where("sale_price <= ?", mp)
-			} else {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_price"})
-				return
-			}
+
+		// Total matching products, before paging
+		query = query.Session(&gorm.Session{})
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count products"})
+			return
 		}
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
 
-		// 5️⃣ Apply category filter
-		if categoryID != "" {
-			if cid, err := strconv.ParseUint(categoryID, 10, 64); err == nil {
-				query = query.
-					Joins("JOIN product_categories pc ON pc.product_id = products.id").
-					Where("pc.category_id = ?", uint(cid))
-			} else {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category_id"})
-				return
-			}
+		// 4️⃣ Apply sorting, with the ID as tie-breaker so pages are stable
+		pageQuery := orderProducts(query, sortKeys, rank, filters.PriceSQL)
+		if paging.Enabled {
+			pageQuery = paginate(pageQuery, paging, sortBy, sortOrder, filters.PriceSQL)
+		}
+		if effectivePrices {
+			pageQuery = pageQuery.Select("products.*, " + filters.PriceSQL + " AS effective_price")
 		}
 
-		// 6️⃣ Apply sorting
-		orderClause := fmt.Sprintf("%s %s", sortBy, sortOrder)
 		var products []models.Product
-		if err := query.Order(orderClause).Find(&products).Error; err != nil {
+		if err := pageQuery.Find(&products).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 			return
 		}
-		// 8️⃣ Return products
+
+		if paging.Enabled {
+			setProductPageLinks(c, paging, products, total, sortBy)
+		}
+
+		// 5️⃣ Show running sale schedules
+		if effectivePrices {
+			if err := models.ApplyPriceSchedules(db, products); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply price schedules"})
+				return
+			}
+		}
+
+		// 6️⃣ Return products, with facets for the filter sidebar when asked
+		if withFacets {
+			facets, err := productFacets(db, filters)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute facets"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"products": products, "facets": facets})
+			return
+		}
 		c.JSON(http.StatusOK, products)
 	}
 }
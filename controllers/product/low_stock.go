@@ -0,0 +1,66 @@
+package productcontroller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// findLowStockProducts returns products at or below their reorder threshold, emptiest first
+func findLowStockProducts(db *gorm.DB) ([]models.Product, error) {
+	var products []models.Product
+	err := db.Preload("Categories").
+		Where("reorder_threshold > 0 AND stock <= reorder_threshold").
+		Order("stock - reorder_threshold ASC, id ASC").
+		Find(&products).Error
+	return products, err
+}
+
+// GetLowStockProducts lists products that need restocking.
+// GET /admin/products/low-stock
+func GetLowStockProducts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		products, err := findLowStockProducts(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch low-stock products"})
+			return
+		}
+		c.JSON(http.StatusOK, products)
+	}
+}
+
+// ExportRestockListToExcel downloads the low-stock products as a restock list for purchasing.
+// GET /admin/products/low-stock/export-excel
+func ExportRestockListToExcel(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		products, err := findLowStockProducts(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch low-stock products"})
+			return
+		}
+
+		file, sheet, err := newExcelSheet("Restock", []string{
+			"ID", "EName", "ARName", "Stock", "ReorderThreshold", "Shortfall", "BaseCost",
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Excel sheet"})
+			return
+		}
+
+		for _, p := range products {
+			row := sheet.AddRow()
+
+			row.AddCell().SetValue(p.ID)
+			row.AddCell().SetValue(p.EName)
+			row.AddCell().SetValue(p.ARName)
+			row.AddCell().SetValue(p.Stock)
+			row.AddCell().SetValue(p.ReorderThreshold)
+			row.AddCell().SetValue(p.ReorderThreshold - p.Stock)
+			row.AddCell().SetValue(p.BaseCost)
+		}
+
+		writeExcelResponse(c, file, "restock.xlsx")
+	}
+}
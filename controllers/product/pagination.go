@@ -0,0 +1,250 @@
+package productcontroller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pagination is how a product listing is paged. Without page, limit or cursor
+// parameters the whole result is returned, as before.
+type pagination struct {
+	Enabled   bool
+	Page      int
+	Limit     int
+	UseCursor bool
+	Cursor    *productCursor // nil on the first cursor page
+}
+
+// productCursor marks the last product of a page: its sort value and ID
+type productCursor struct {
+	Value interface{}
+	ID    uint
+}
+
+// cursorField knows how to read a sort column from a product for keyset paging
+type cursorField struct {
+	value func(p models.Product) interface{}
+	parse func(raw json.RawMessage) (interface{}, error)
+}
+
+// cursorFields are the sort columns cursor paging supports, when sorting by one column
+var cursorFields = map[string]cursorField{
+	"id": {
+		value: func(p models.Product) interface{} { return p.ID },
+		parse: parseAs[uint],
+	},
+	"created_at": {
+		value: func(p models.Product) interface{} { return p.CreatedAt },
+		parse: parseAs[time.Time],
+	},
+	"updated_at": {
+		value: func(p models.Product) interface{} { return p.UpdatedAt },
+		parse: parseAs[time.Time],
+	},
+	"sale_price": {
+		value: func(p models.Product) interface{} {
+			if p.EffectivePrice != nil {
+				return *p.EffectivePrice
+			}
+			return p.SalePrice
+		},
+		parse: parseAs[float64],
+	},
+	"regular_price": {
+		value: func(p models.Product) interface{} { return p.RegularPrice },
+		parse: parseAs[float64],
+	},
+	"e_name": {
+		value: func(p models.Product) interface{} { return p.EName },
+		parse: parseAs[string],
+	},
+	"ar_name": {
+		value: func(p models.Product) interface{} { return p.ARName },
+		parse: parseAs[string],
+	},
+	"stock": {
+		value: func(p models.Product) interface{} { return p.Stock },
+		parse: parseAs[int],
+	},
+	"weight": {
+		value: func(p models.Product) interface{} { return p.Weight },
+		parse: parseAs[float64],
+	},
+}
+
+// parseAs decodes a cursor value of type T
+func parseAs[T any](raw json.RawMessage) (interface{}, error) {
+	var v T
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+// parsePagination reads page/limit or cursor/limit from the query string
+func parsePagination(c *gin.Context, sortBy string) (pagination, error) {
+	var p pagination
+	limitStr, hasLimit := c.GetQuery("limit")
+	pageStr, hasPage := c.GetQuery("page")
+	cursorStr, hasCursor := c.GetQuery("cursor")
+	if !hasLimit && !hasPage && !hasCursor {
+		return p, nil
+	}
+
+	p.Enabled = true
+	p.Page = 1
+	p.Limit = defaultPageLimit
+	if hasLimit {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return p, errors.New("Invalid limit")
+		}
+		p.Limit = min(limit, maxPageLimit)
+	}
+
+	if hasCursor {
+		if hasPage {
+			return p, errors.New("Use either page or cursor, not both")
+		}
+		if _, ok := cursorFields[sortBy]; !ok {
+			return p, fmt.Errorf("Cursor paging is not supported when sorting by %s", sortBy)
+		}
+		p.UseCursor = true
+		if cursorStr != "" {
+			cursor, err := decodeCursor(cursorStr, sortBy)
+			if err != nil {
+				return p, errors.New("Invalid cursor")
+			}
+			p.Cursor = cursor
+		}
+		return p, nil
+	}
+
+	if hasPage {
+		page, err := strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			return p, errors.New("Invalid page")
+		}
+		p.Page = page
+	}
+	return p, nil
+}
+
+// paginate limits an ordered product query to the requested page.
+// Cursor pages continue after the cursor's sort value and ID (keyset paging).
+func paginate(query *gorm.DB, p pagination, sortBy, sortOrder, priceSQL string) *gorm.DB {
+	if !p.UseCursor {
+		return query.Offset((p.Page - 1) * p.Limit).Limit(p.Limit)
+	}
+
+	if p.Cursor != nil {
+		op := "<"
+		if sortOrder == "asc" {
+			op = ">"
+		}
+		column := sortExpression(sortBy, priceSQL)
+		query = query.Where(fmt.Sprintf("(%s, products.id) %s (?, ?)", column, op), p.Cursor.Value, p.Cursor.ID)
+	}
+	return query.Limit(p.Limit)
+}
+
+// setProductPageLinks writes the Link header for a page of products
+func setProductPageLinks(c *gin.Context, p pagination, products []models.Product, total int64, sortBy string) {
+	links := map[string]url.Values{}
+	limit := strconv.Itoa(p.Limit)
+
+	if p.UseCursor {
+		links["first"] = withQuery(c, map[string]string{"cursor": "", "limit": limit})
+		if len(products) == p.Limit {
+			next := encodeCursor(products[len(products)-1], sortBy)
+			links["next"] = withQuery(c, map[string]string{"cursor": next, "limit": limit})
+		}
+		setPageLinks(c, links)
+		return
+	}
+
+	lastPage := int((total + int64(p.Limit) - 1) / int64(p.Limit))
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	page := func(n int) url.Values {
+		return withQuery(c, map[string]string{"page": strconv.Itoa(n), "limit": limit})
+	}
+	links["first"] = page(1)
+	links["last"] = page(lastPage)
+	if p.Page > 1 {
+		links["prev"] = page(min(p.Page-1, lastPage))
+	}
+	if p.Page < lastPage {
+		links["next"] = page(p.Page + 1)
+	}
+	setPageLinks(c, links)
+}
+
+// encodeCursor builds the opaque cursor pointing after product p
+func encodeCursor(p models.Product, sortBy string) string {
+	data, _ := json.Marshal([]interface{}{cursorFields[sortBy].value(p), p.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads a cursor made by encodeCursor for the same sort column
+func decodeCursor(token, sortBy string) (*productCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil || len(parts) != 2 {
+		return nil, errors.New("malformed cursor")
+	}
+
+	value, err := cursorFields[sortBy].parse(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	var id uint
+	if err := json.Unmarshal(parts[1], &id); err != nil {
+		return nil, err
+	}
+	return &productCursor{Value: value, ID: id}, nil
+}
+
+// setPageLinks writes an RFC 8288 Link header for the pages around the current one
+func setPageLinks(c *gin.Context, links map[string]url.Values) {
+	var parts []string
+	for _, rel := range []string{"first", "prev", "next", "last"} {
+		query, ok := links[rel]
+		if !ok {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf(`<%s?%s>; rel="%s"`, c.Request.URL.Path, query.Encode(), rel))
+	}
+	if len(parts) > 0 {
+		c.Header("Link", strings.Join(parts, ", "))
+	}
+}
+
+// withQuery copies the request's query string with the given parameters replaced
+func withQuery(c *gin.Context, set map[string]string) url.Values {
+	query := url.Values{}
+	for k, v := range c.Request.URL.Query() {
+		query[k] = append([]string(nil), v...)
+	}
+	for k, v := range set {
+		query.Set(k, v)
+	}
+	return query
+}
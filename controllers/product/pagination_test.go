@@ -0,0 +1,137 @@
+package productcontroller
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 30, 0, 123456000, time.UTC)
+	sale := 79.5
+	product := models.Product{
+		ID:           42,
+		EName:        "Frying pan, 28cm",
+		ARName:       "مقلاة",
+		SalePrice:    99.99,
+		RegularPrice: 120,
+		Stock:        7,
+		Weight:       1.25,
+		CreatedAt:    created,
+		UpdatedAt:    created.Add(time.Hour),
+	}
+	onSale := product
+	onSale.EffectivePrice = &sale
+
+	tests := []struct {
+		sortBy  string
+		product models.Product
+		want    interface{}
+	}{
+		{"id", product, uint(42)},
+		{"created_at", product, created},
+		{"updated_at", product, created.Add(time.Hour)},
+		{"sale_price", product, 99.99},
+		{"sale_price", onSale, 79.5},
+		{"regular_price", product, 120.0},
+		{"e_name", product, "Frying pan, 28cm"},
+		{"ar_name", product, "مقلاة"},
+		{"stock", product, 7},
+		{"weight", product, 1.25},
+	}
+	for _, tt := range tests {
+		cursor, err := decodeCursor(encodeCursor(tt.product, tt.sortBy), tt.sortBy)
+		if err != nil {
+			t.Errorf("%s: decode: %v", tt.sortBy, err)
+			continue
+		}
+		if cursor.ID != 42 {
+			t.Errorf("%s: got ID %d, want 42", tt.sortBy, cursor.ID)
+		}
+		if got, ok := cursor.Value.(time.Time); ok {
+			if !got.Equal(tt.want.(time.Time)) {
+				t.Errorf("%s: got %v, want %v", tt.sortBy, got, tt.want)
+			}
+		} else if !reflect.DeepEqual(cursor.Value, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.sortBy, cursor.Value, tt.want)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsMalformed(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		token  string
+		sortBy string
+	}{
+		{"not base64", "!!not-base64!!", "id"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`[1,2]`)), "id"},
+		{"not JSON", encode("hello"), "id"},
+		{"object", encode(`{"value":1,"id":2}`), "id"},
+		{"one part", encode(`[1]`), "id"},
+		{"three parts", encode(`[1,2,3]`), "id"},
+		{"value of the wrong type", encode(`["seven",2]`), "stock"},
+		{"bad time", encode(`["yesterday",2]`), "created_at"},
+		{"string ID", encode(`[1,"2"]`), "id"},
+		{"negative ID", encode(`[1,-2]`), "id"},
+		{"injection attempt", encode(`["1) OR 1=1 --",2]`), "sale_price"},
+	}
+	for _, tt := range tests {
+		if cursor, err := decodeCursor(tt.token, tt.sortBy); err == nil {
+			t.Errorf("%s: decoded %+v, want an error", tt.name, cursor)
+		}
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	cursor := encodeCursor(models.Product{ID: 9, Stock: 3}, "stock")
+
+	tests := []struct {
+		name    string
+		query   string
+		sortBy  string
+		want    pagination
+		wantErr bool
+	}{
+		{"unpaged", "", "created_at", pagination{}, false},
+		{"empty page", "?page=", "created_at", pagination{}, true},
+		{"limit only", "?limit=5", "created_at", pagination{Enabled: true, Page: 1, Limit: 5}, false},
+		{"page", "?page=3", "created_at", pagination{Enabled: true, Page: 3, Limit: defaultPageLimit}, false},
+		{"limit capped", "?limit=1000", "created_at", pagination{Enabled: true, Page: 1, Limit: maxPageLimit}, false},
+		{"zero limit", "?limit=0", "created_at", pagination{}, true},
+		{"negative page", "?page=-1", "created_at", pagination{}, true},
+		{"non-numeric limit", "?limit=ten", "created_at", pagination{}, true},
+		{"first cursor page", "?cursor=", "stock", pagination{Enabled: true, Page: 1, Limit: defaultPageLimit, UseCursor: true}, false},
+		{"next cursor page", "?cursor=" + cursor + "&limit=10", "stock", pagination{
+			Enabled: true, Page: 1, Limit: 10, UseCursor: true, Cursor: &productCursor{Value: 3, ID: 9},
+		}, false},
+		{"cursor and page", "?cursor=&page=2", "stock", pagination{}, true},
+		{"cursor for another sort", "?cursor=" + cursor, "e_name", pagination{}, true},
+		{"cursor with a multi-key sort", "?cursor=", "sale_price,created_at", pagination{}, true},
+		{"cursor with relevance", "?cursor=", relevanceSort, pagination{}, true},
+		{"garbage cursor", "?cursor=%25%25", "stock", pagination{}, true},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/products"+tt.query, nil)
+
+		got, err := parsePagination(c, tt.sortBy)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %+v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v (cursor %+v), %v; want %+v", tt.name, got, got.Cursor, err, tt.want)
+		}
+	}
+}
@@ -31,6 +31,7 @@ func CreateProduct(db *gorm.DB) gin.HandlerFunc {
 		ardescription := c.PostForm("ardescription")
 		regularPriceStr := c.PostForm("regular_price")
 		baseCostStr := c.PostForm("base_cost")
+		reorderThresholdStr := c.PostForm("reorder_threshold")
 		categoryIDsStr := c.PostForm("category_ids")
 
 		// Convert numerics
@@ -63,6 +64,16 @@ func CreateProduct(db *gorm.DB) gin.HandlerFunc {
 			}
 		}
 
+		var reorderThreshold int
+		if reorderThresholdStr != "" {
+			if rt, parseErr := strconv.Atoi(reorderThresholdStr); parseErr == nil && rt >= 0 {
+				reorderThreshold = rt
+			} else {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reorder_threshold"})
+				return
+			}
+		}
+
 		// Categories
 		var categories []models.Category
 		if categoryIDsStr != "" {
@@ -120,16 +131,17 @@ func CreateProduct(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		newProduct := models.Product{
-			EName:         ename,
-			ARName:        arname,
-			EDescription:  edescription,
-			ARDescription: ardescription,
-			SalePrice:     salePrice,
-			RegularPrice:  regularPrice,
-			BaseCost:      baseCost,
-			Weight:        weight,
-			Image:         imageURL,
-			Categories:    categories,
+			EName:            ename,
+			ARName:           arname,
+			EDescription:     edescription,
+			ARDescription:    ardescription,
+			SalePrice:        salePrice,
+			RegularPrice:     regularPrice,
+			BaseCost:         baseCost,
+			Weight:           weight,
+			ReorderThreshold: reorderThreshold,
+			Image:            imageURL,
+			Categories:       categories,
 		}
 
 		if err := tx.Create(&newProduct).Error; err != nil {
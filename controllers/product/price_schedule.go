@@ -0,0 +1,163 @@
+package productcontroller
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// PriceScheduleInput is the admin payload for creating or updating a price schedule
+type PriceScheduleInput struct {
+	Name       string    `json:"name"`
+	ProductID  *uint     `json:"product_id"`
+	CategoryID *uint     `json:"category_id"`
+	SalePrice  float64   `json:"sale_price" binding:"min=0"`
+	PercentOff float64   `json:"percent_off" binding:"min=0,max=100"`
+	StartsAt   time.Time `json:"starts_at" binding:"required"`
+	EndsAt     time.Time `json:"ends_at" binding:"required"`
+}
+
+// apply validates the input and copies it onto a schedule
+func (in PriceScheduleInput) apply(db *gorm.DB, schedule *models.PriceSchedule) error {
+	if (in.ProductID == nil) == (in.CategoryID == nil) {
+		return errors.New("set exactly one of product_id or category_id")
+	}
+	if (in.SalePrice > 0) == (in.PercentOff > 0) {
+		return errors.New("set exactly one of sale_price or percent_off")
+	}
+	if !in.EndsAt.After(in.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	if in.ProductID != nil {
+		if err := db.Select("id").First(&models.Product{}, *in.ProductID).Error; err != nil {
+			return errors.New("product not found")
+		}
+	}
+	if in.CategoryID != nil {
+		if err := db.Select("id").First(&models.Category{}, *in.CategoryID).Error; err != nil {
+			return errors.New("category not found")
+		}
+	}
+
+	schedule.Name = in.Name
+	schedule.ProductID = in.ProductID
+	schedule.CategoryID = in.CategoryID
+	schedule.SalePrice = in.SalePrice
+	schedule.PercentOff = in.PercentOff
+	schedule.StartsAt = in.StartsAt
+	schedule.EndsAt = in.EndsAt
+	return nil
+}
+
+// GetPriceSchedules lists price schedules, soonest first.
+// Optional filter: ?status=active|upcoming|expired (default: active and upcoming)
+// GET /admin/price-schedules
+func GetPriceSchedules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		query := db.Model(&models.PriceSchedule{})
+		switch c.Query("status") {
+		case "active":
+			query = query.Where("starts_at <= ? AND ends_at > ?", now, now)
+		case "upcoming":
+			query = query.Where("starts_at > ?", now)
+		case "expired":
+			query = query.Where("ends_at <= ?", now)
+		case "":
+			query = query.Where("ends_at > ?", now)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+
+		var schedules []models.PriceSchedule
+		if err := query.Order("starts_at ASC, id ASC").Find(&schedules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price schedules"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(schedules))
+		for _, s := range schedules {
+			status := "active"
+			if s.StartsAt.After(now) {
+				status = "upcoming"
+			} else if !s.EndsAt.After(now) {
+				status = "expired"
+			}
+			result = append(result, gin.H{"schedule": s, "status": status})
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// CreatePriceSchedule schedules a sale.
+// POST /admin/price-schedules
+func CreatePriceSchedule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input PriceScheduleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var schedule models.PriceSchedule
+		if err := input.apply(db, &schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Create(&schedule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create price schedule"})
+			return
+		}
+		c.JSON(http.StatusCreated, schedule)
+	}
+}
+
+// UpdatePriceSchedule changes a scheduled sale.
+// PUT /admin/price-schedules/:id
+func UpdatePriceSchedule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var schedule models.PriceSchedule
+		if err := db.First(&schedule, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Price schedule not found"})
+			return
+		}
+
+		var input PriceScheduleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := input.apply(db, &schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Save(&schedule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update price schedule"})
+			return
+		}
+		c.JSON(http.StatusOK, schedule)
+	}
+}
+
+// DeletePriceSchedule cancels a scheduled sale.
+// DELETE /admin/price-schedules/:id
+func DeletePriceSchedule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := db.Delete(&models.PriceSchedule{}, "id = ?", c.Param("id"))
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete price schedule"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Price schedule not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Price schedule deleted"})
+	}
+}
@@ -10,8 +10,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/middleware"
 	"github.com/junaidrashid-git/ecommerce-api/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const uploadDir = "/var/www/trendybacked/uploads/products"
@@ -82,8 +84,9 @@ func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
 		if v := parseFloat(c.PostForm("weight")); v != nil {
 			product.Weight = *v
 		}
-		if v := parseInt(c.PostForm("stock")); v != nil { // 👈 Stock support
-			product.Stock = *v
+		newStock := parseInt(c.PostForm("stock")) // 👈 Stock support
+		if v := parseInt(c.PostForm("reorder_threshold")); v != nil && *v >= 0 {
+			product.ReorderThreshold = *v
 		}
 
 		// Update categories if provided
@@ -133,8 +136,25 @@ func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
 			product.Image = fmt.Sprintf("/uploads/products/%s", filename)
 		}
 
-		// Save updated product
-		if err := db.Save(&product).Error; err != nil {
+		// Save updated product, recording any stock change in the ledger
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Re-read stock under lock so sales since the product was loaded aren't overwritten
+			var current models.Product
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "stock").First(&current, product.ID).Error; err != nil {
+				return err
+			}
+			product.Stock = current.Stock
+			if newStock != nil {
+				product.Stock = *newStock
+			}
+
+			if err := tx.Save(&product).Error; err != nil {
+				return err
+			}
+			return models.RecordStockMovement(tx, product.ID, product.Stock-current.Stock, product.Stock,
+				models.StockMovementAdjustment, "", middleware.Actor(c))
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
 			return
 		}
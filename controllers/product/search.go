@@ -0,0 +1,137 @@
+package productcontroller
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// productSearch holds the full-text search setup detected at startup.
+// Until EnsureProductSearch succeeds, searches fall back to ILIKE.
+var productSearch struct {
+	ready          bool
+	arabicConfig   string // "arabic" when the server has it, else "simple"
+	trigram        bool   // pg_trgm is available for typo tolerance
+	englishVector  string
+	arabicVector   string
+	arabicNameNorm string
+}
+
+// arabicNormalizeSQL strips Arabic diacritics and tatweel and folds alef forms,
+// alef maqsura and taa marbuta, mirroring normalizeArabic.
+const arabicNormalizeSQL = `
+CREATE OR REPLACE FUNCTION ar_normalize(t text) RETURNS text AS $$
+	SELECT translate(
+		regexp_replace(t, '[\u064B-\u065F\u0670\u0640]', '', 'g'),
+		'أإآٱىة', 'اااايه'
+	)
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE`
+
+// EnsureProductSearch creates the Arabic normalization function and the
+// full-text and trigram indexes product search uses.
+func EnsureProductSearch(db *gorm.DB) {
+	if err := db.Exec(arabicNormalizeSQL).Error; err != nil {
+		log.Printf("❌ Product search disabled, failed to create ar_normalize: %v", err)
+		return
+	}
+
+	arabicConfig := "simple"
+	var hasArabic bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'arabic')").Scan(&hasArabic).Error; err == nil && hasArabic {
+		arabicConfig = "arabic"
+	}
+
+	englishVector := "to_tsvector('english', coalesce(products.e_name, '') || ' ' || coalesce(products.e_description, ''))"
+	arabicVector := fmt.Sprintf("to_tsvector('%s', ar_normalize(coalesce(products.ar_name, '') || ' ' || coalesce(products.ar_description, '')))", arabicConfig)
+	arabicNameNorm := "ar_normalize(coalesce(products.ar_name, ''))"
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_products_search_en ON products USING gin (" + englishVector + ")",
+		"CREATE INDEX IF NOT EXISTS idx_products_search_ar ON products USING gin (" + arabicVector + ")",
+	}
+	for _, stmt := range indexes {
+		if err := db.Exec(stmt).Error; err != nil {
+			log.Printf("❌ Product search disabled, failed to create index: %v", err)
+			return
+		}
+	}
+
+	trigram := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error == nil
+	if trigram {
+		for _, stmt := range []string{
+			"CREATE INDEX IF NOT EXISTS idx_products_trgm_en ON products USING gin (e_name gin_trgm_ops)",
+			"CREATE INDEX IF NOT EXISTS idx_products_trgm_ar ON products USING gin (" + arabicNameNorm + " gin_trgm_ops)",
+		} {
+			if err := db.Exec(stmt).Error; err != nil {
+				log.Printf("⚠️ Typo-tolerant search disabled, failed to create trigram index: %v", err)
+				trigram = false
+				break
+			}
+		}
+	} else {
+		log.Println("⚠️ pg_trgm is not available, typo-tolerant search disabled")
+	}
+
+	productSearch.arabicConfig = arabicConfig
+	productSearch.trigram = trigram
+	productSearch.englishVector = englishVector
+	productSearch.arabicVector = arabicVector
+	productSearch.arabicNameNorm = arabicNameNorm
+	productSearch.ready = true
+	log.Printf("✅ Product search ready (arabic config: %s, trigram: %v)", arabicConfig, trigram)
+}
+
+// arabicNormalizer folds letter variants the way ar_normalize does
+var arabicNormalizer = strings.NewReplacer(
+	"أ", "ا", "إ", "ا", "آ", "ا", "ٱ", "ا",
+	"ى", "ي",
+	"ة", "ه",
+)
+
+// normalizeArabic strips diacritics and tatweel and folds alef forms,
+// alef maqsura and taa marbuta so spelling variants match.
+func normalizeArabic(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if (r >= 0x064B && r <= 0x065F) || r == 0x0670 || r == 0x0640 {
+			return -1
+		}
+		return r
+	}, s)
+	return arabicNormalizer.Replace(s)
+}
+
+// applySearch filters products matching the search term and returns the
+// relevance expression to order by. Without full-text search it falls back to
+// ILIKE and returns nil.
+func applySearch(query *gorm.DB, search string) (*gorm.DB, *clause.Expr) {
+	if !productSearch.ready {
+		likePattern := "%" + search + "%"
+		return query.Where(`
+			e_name ILIKE ? OR e_description ILIKE ? OR ar_name ILIKE ? OR ar_description ILIKE ?
+		`, likePattern, likePattern, likePattern, likePattern), nil
+	}
+
+	normalized := normalizeArabic(search)
+	enQuery := "websearch_to_tsquery('english', ?)"
+	arQuery := fmt.Sprintf("websearch_to_tsquery('%s', ?)", productSearch.arabicConfig)
+
+	match := fmt.Sprintf("%s @@ %s OR %s @@ %s",
+		productSearch.englishVector, enQuery, productSearch.arabicVector, arQuery)
+	matchVars := []interface{}{search, normalized}
+
+	rank := fmt.Sprintf("ts_rank(%s, %s) + ts_rank(%s, %s)",
+		productSearch.englishVector, enQuery, productSearch.arabicVector, arQuery)
+	rankVars := []interface{}{search, normalized}
+
+	if productSearch.trigram {
+		match += fmt.Sprintf(" OR products.e_name %% ? OR %s %% ?", productSearch.arabicNameNorm)
+		matchVars = append(matchVars, search, normalized)
+		rank += fmt.Sprintf(" + similarity(products.e_name, ?) + similarity(%s, ?)", productSearch.arabicNameNorm)
+		rankVars = append(rankVars, search, normalized)
+	}
+
+	return query.Where("("+match+")", matchVars...), &clause.Expr{SQL: rank, Vars: rankVars}
+}
@@ -0,0 +1,107 @@
+package productcontroller
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/junaidrashid-git/ecommerce-api/internal/testdb"
+)
+
+// arabicNormalizeCases are spellings normalizeArabic and ar_normalize must fold alike
+var arabicNormalizeCases = []struct {
+	name, in, want string
+}{
+	{"alef with hamza above", "أحمد", "احمد"},
+	{"alef with hamza below", "إسلام", "اسلام"},
+	{"alef with madda", "آلة", "اله"},
+	{"alef wasla", "ٱلكتاب", "الكتاب"},
+	{"alef maqsura", "مستشفى", "مستشفي"},
+	{"yaa unchanged", "كرسي", "كرسي"},
+	{"taa marbuta", "طاولة", "طاوله"},
+	{"haa unchanged", "وجه", "وجه"},
+	{"fatha damma kasra", "كَتُبِ", "كتب"},
+	{"tanween", "كتابًا", "كتابا"},
+	{"shadda and sukun", "مُدَرِّسْ", "مدرس"},
+	{"superscript alef", "هٰذا", "هذا"},
+	{"tatweel", "مـــطبخ", "مطبخ"},
+	{"everything at once", "الْمَكْتَبَـةُ الأُولَى", "المكتبه الاولي"},
+	{"latin untouched", "Frying Pan 28cm", "Frying Pan 28cm"},
+	{"mixed", "مقلاة Tefal", "مقلاه Tefal"},
+	{"empty", "", ""},
+}
+
+func TestNormalizeArabic(t *testing.T) {
+	for _, tt := range arabicNormalizeCases {
+		if got := normalizeArabic(tt.in); got != tt.want {
+			t.Errorf("%s: normalizeArabic(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+// sqlArabicNormalizer applies the regexp_replace and translate in arabicNormalizeSQL
+// in Go, so the SQL function can be checked against normalizeArabic without a database
+func sqlArabicNormalizer(t *testing.T) func(string) string {
+	t.Helper()
+	parts := regexp.MustCompile(`regexp_replace\(t, '([^']*)', '', 'g'\),\s*'([^']*)', '([^']*)'`).
+		FindStringSubmatch(arabicNormalizeSQL)
+	if parts == nil {
+		t.Fatal("arabicNormalizeSQL no longer has the expected regexp_replace and translate")
+	}
+
+	// Postgres writes code points as \uXXXX, Go as \x{XXXX}
+	class := regexp.MustCompile(`\\u([0-9A-Fa-f]{4})`).ReplaceAllString(parts[1], `\x{$1}`)
+	strip := regexp.MustCompile(class)
+	from, to := []rune(parts[2]), []rune(parts[3])
+	if len(from) != len(to) {
+		t.Fatalf("translate maps %d characters to %d", len(from), len(to))
+	}
+	fold := make(map[rune]rune, len(from))
+	for i, r := range from {
+		fold[r] = to[i]
+	}
+
+	return func(s string) string {
+		s = strip.ReplaceAllString(s, "")
+		return strings.Map(func(r rune) rune {
+			if f, ok := fold[r]; ok {
+				return f
+			}
+			return r
+		}, s)
+	}
+}
+
+func TestNormalizeArabicMatchesSQL(t *testing.T) {
+	arNormalize := sqlArabicNormalizer(t)
+	for _, tt := range arabicNormalizeCases {
+		if got := arNormalize(tt.in); got != tt.want {
+			t.Errorf("%s: ar_normalize(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+
+	// Every character of the Arabic blocks, one at a time
+	for r := rune(0x0600); r <= 0x06FF; r++ {
+		s := "ب" + string(r) + "ب"
+		if sql, goNorm := arNormalize(s), normalizeArabic(s); sql != goNorm {
+			t.Errorf("U+%04X: ar_normalize gives %s, normalizeArabic %s", r, strconv.Quote(sql), strconv.Quote(goNorm))
+		}
+	}
+}
+
+func TestNormalizeArabicMatchesPostgres(t *testing.T) {
+	db := testdb.Open(t)
+	if err := db.Exec(arabicNormalizeSQL).Error; err != nil {
+		t.Fatalf("create ar_normalize: %v", err)
+	}
+	for _, tt := range arabicNormalizeCases {
+		var got string
+		if err := db.Raw("SELECT ar_normalize(?)", tt.in).Scan(&got).Error; err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: ar_normalize(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
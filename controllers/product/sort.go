@@ -0,0 +1,154 @@
+package productcontroller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxSortKeys caps how many fields one listing can be sorted by
+const maxSortKeys = 3
+
+// relevanceSort orders by search relevance; it only applies to ranked searches
+const relevanceSort = "relevance"
+
+// sortColumns are the fields products can be sorted by, keyed by the name
+// clients pass in sort_by. Only these columns ever reach the ORDER BY clause.
+var sortColumns = map[string]string{
+	"id":            "id",
+	"created_at":    "created_at",
+	"updated_at":    "updated_at",
+	"price":         "sale_price",
+	"sale_price":    "sale_price",
+	"regular_price": "regular_price",
+	"name":          "e_name",
+	"e_name":        "e_name",
+	"ar_name":       "ar_name",
+	"stock":         "stock",
+	"weight":        "weight",
+}
+
+// sortKey is one field of a product sort: a column from sortColumns or relevanceSort
+type sortKey struct {
+	Column string
+	Desc   bool
+}
+
+// direction returns the SQL keyword for the key's order
+func (k sortKey) direction() string {
+	if k.Desc {
+		return "desc"
+	}
+	return "asc"
+}
+
+// parseSort reads sort_by as a comma separated list of fields, each optionally
+// suffixed with :asc or :desc; fields without one use defaultOrder.
+// For example "price:asc,created_at" with order=desc. Relevance is ignored
+// unless the search is ranked, and it is the default sort when it is;
+// otherwise products are sorted by created_at.
+func parseSort(sortBy, defaultOrder string, ranked bool) ([]sortKey, error) {
+	defaultOrder = strings.ToLower(defaultOrder)
+	if defaultOrder == "" {
+		defaultOrder = "desc"
+	}
+	if defaultOrder != "asc" && defaultOrder != "desc" {
+		return nil, errors.New("Invalid order, use asc or desc")
+	}
+
+	var keys []sortKey
+	seen := map[string]bool{}
+	for _, part := range strings.Split(sortBy, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, order, hasOrder := strings.Cut(part, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		order = strings.ToLower(strings.TrimSpace(order))
+		if !hasOrder {
+			order = defaultOrder
+		}
+		if order != "asc" && order != "desc" {
+			return nil, fmt.Errorf("Invalid sort order for %s, use asc or desc", name)
+		}
+
+		column, ok := sortColumns[name]
+		if name == relevanceSort {
+			if !ranked {
+				continue
+			}
+			column, ok = relevanceSort, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("Cannot sort by %s", name)
+		}
+		if seen[column] {
+			continue
+		}
+		seen[column] = true
+		keys = append(keys, sortKey{Column: column, Desc: order == "desc"})
+	}
+
+	if len(keys) > maxSortKeys {
+		return nil, fmt.Errorf("Sort by at most %d fields", maxSortKeys)
+	}
+	if len(keys) == 0 {
+		column := "created_at"
+		if ranked {
+			column = relevanceSort
+		}
+		keys = append(keys, sortKey{Column: column, Desc: defaultOrder == "desc"})
+	}
+	return keys, nil
+}
+
+// sortSpec names a sort for cursors and error messages, e.g. "sale_price,created_at"
+func sortSpec(keys []sortKey) string {
+	columns := make([]string, len(keys))
+	for i, k := range keys {
+		columns[i] = k.Column
+	}
+	return strings.Join(columns, ",")
+}
+
+// sortExpression is the SQL a sort column orders by. Prices sort by priceSQL,
+// the same price the listing filters on.
+func sortExpression(column, priceSQL string) string {
+	if column == "sale_price" {
+		return priceSQL
+	}
+	return "products." + column
+}
+
+// orderProducts applies the sort keys to a product query, with the ID as the
+// final tie-breaker so pages are stable. rank is the search relevance
+// expression a relevance key orders by.
+func orderProducts(query *gorm.DB, keys []sortKey, rank *clause.Expr, priceSQL string) *gorm.DB {
+	var (
+		parts []string
+		vars  []interface{}
+		hasID bool
+	)
+	for _, k := range keys {
+		if k.Column == relevanceSort {
+			parts = append(parts, "("+rank.SQL+") "+k.direction())
+			vars = append(vars, rank.Vars...)
+			continue
+		}
+		hasID = hasID || k.Column == "id"
+		parts = append(parts, sortExpression(k.Column, priceSQL)+" "+k.direction())
+	}
+	if !hasID {
+		parts = append(parts, "products.id "+keys[len(keys)-1].direction())
+	}
+
+	return query.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:                strings.Join(parts, ", "),
+		Vars:               vars,
+		WithoutParentheses: true,
+	}})
+}
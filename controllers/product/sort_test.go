@@ -0,0 +1,81 @@
+package productcontroller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		sortBy  string
+		order   string
+		ranked  bool
+		want    []sortKey
+		wantErr bool
+	}{
+		{"default", "", "", false, []sortKey{{"created_at", true}}, false},
+		{"default ascending", "", "asc", false, []sortKey{{"created_at", false}}, false},
+		{"default when ranked", "", "", true, []sortKey{{relevanceSort, true}}, false},
+		{"alias", "price", "asc", false, []sortKey{{"sale_price", false}}, false},
+		{"case and spaces", " Name : DESC ", "asc", false, []sortKey{{"e_name", true}}, false},
+		{"multi-key", "price:asc,created_at", "desc", false, []sortKey{{"sale_price", false}, {"created_at", true}}, false},
+		{"duplicate through alias", "price,sale_price:asc", "desc", false, []sortKey{{"sale_price", true}}, false},
+		{"empty parts", ",stock,,", "", false, []sortKey{{"stock", true}}, false},
+		{"relevance ignored unranked", "relevance,stock", "", false, []sortKey{{"stock", true}}, false},
+		{"relevance when ranked", "relevance,stock:asc", "", true, []sortKey{{relevanceSort, true}, {"stock", false}}, false},
+		{"only relevance unranked", "relevance", "asc", false, []sortKey{{"created_at", false}}, false},
+		{"three keys", "stock,weight,id", "", false, []sortKey{{"stock", true}, {"weight", true}, {"id", true}}, false},
+		{"too many keys", "stock,weight,id,e_name", "", false, nil, true},
+		{"unknown key", "base_cost", "", false, nil, true},
+		{"column not exposed", "deleted_at", "", false, nil, true},
+		{"injection attempt", "sale_price;DROP TABLE products", "", false, nil, true},
+		{"bad default order", "stock", "sideways", false, nil, true},
+		{"bad key order", "stock:up", "", false, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSort(tt.sortBy, tt.order, tt.ranked)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %+v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, %v; want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestOrderProducts(t *testing.T) {
+	// Dry run: statements are built but never sent, so no database is needed
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("open dry-run database: %v", err)
+	}
+	rank := &clause.Expr{SQL: "ts_rank(x, ?)", Vars: []interface{}{"pan"}}
+
+	tests := []struct {
+		name string
+		keys []sortKey
+		want string
+	}{
+		{"id tie-breaker follows the last key", []sortKey{{"sale_price", false}}, "ORDER BY (PRICE) asc, products.id asc"},
+		{"multi-key", []sortKey{{"stock", true}, {"e_name", false}}, "ORDER BY products.stock desc, products.e_name asc, products.id asc"},
+		{"no tie-breaker when sorting by id", []sortKey{{"id", true}}, "ORDER BY products.id desc"},
+		{"relevance", []sortKey{{relevanceSort, true}}, "ORDER BY (ts_rank(x, $1)) desc, products.id desc"},
+	}
+	for _, tt := range tests {
+		query := orderProducts(db.Model(&models.Product{}), tt.keys, rank, "(PRICE)")
+		sql := query.Find(&[]models.Product{}).Statement.SQL.String()
+		if !strings.HasSuffix(sql, tt.want) {
+			t.Errorf("%s: got %q, want it to end with %q", tt.name, sql, tt.want)
+		}
+	}
+}
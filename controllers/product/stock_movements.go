@@ -0,0 +1,34 @@
+package productcontroller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// GetStockMovements returns a product's stock ledger, newest first.
+// Optional filter: ?reason=sale
+func GetStockMovements(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+
+		query := db.Model(&models.StockMovement{}).Where("product_id = ?", id)
+		if reason := c.Query("reason"); reason != "" {
+			query = query.Where("reason = ?", reason)
+		}
+
+		var movements []models.StockMovement
+		if err := query.Order("created_at DESC, id DESC").Limit(500).Find(&movements).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock movements"})
+			return
+		}
+		c.JSON(http.StatusOK, movements)
+	}
+}
@@ -0,0 +1,56 @@
+package telrControllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// ListPaymentSessions returns payment sessions, newest first.
+// Optional filters: ?status=failed&user_id=xxx&cart_id=1&reference=1-20&tran_ref=xxx
+func ListPaymentSessions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Model(&models.PaymentSession{})
+
+		filters := map[string]string{
+			"status":    "status = ?",
+			"user_id":   "user_id = ?",
+			"cart_id":   "cart_id = ?",
+			"reference": "reference = ?",
+			"telr_ref":  "telr_ref = ?",
+			"tran_ref":  "tran_ref = ?",
+		}
+		for param, clause := range filters {
+			if v := c.Query(param); v != "" {
+				query = query.Where(clause, v)
+			}
+		}
+
+		var sessions []models.PaymentSession
+		if err := query.Order("created_at DESC").Find(&sessions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment sessions"})
+			return
+		}
+		c.JSON(http.StatusOK, sessions)
+	}
+}
+
+// GetPaymentSession returns a single payment session with its order, if one was placed.
+func GetPaymentSession(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var session models.PaymentSession
+		if err := db.Preload("Order.Items").First(&session, "id = ?", id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Payment session not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment session"})
+			return
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
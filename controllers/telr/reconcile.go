@@ -0,0 +1,96 @@
+package telrControllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	orderControllers "github.com/junaidrashid-git/ecommerce-api/controllers/order"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"github.com/junaidrashid-git/ecommerce-api/payment"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReconcilePendingPayments asks the provider about sessions still pending after olderThan,
+// in case their webhook was lost, and places or fails the order accordingly.
+// It returns the number of sessions that reached a final status, and how many of
+// those were paid at the gateway but could not be settled and need review.
+func ReconcilePendingPayments(db *gorm.DB, provider payment.PaymentProvider, olderThan time.Duration) (resolved, failed int, err error) {
+	var sessions []models.PaymentSession
+	if err := db.Where("status = ? AND provider = ? AND telr_ref <> '' AND created_at < ?",
+		models.PaymentSessionPending, provider.Name(), time.Now().Add(-olderThan)).
+		Order("created_at").Find(&sessions).Error; err != nil {
+		return 0, 0, err
+	}
+
+	for _, session := range sessions {
+		result, err := provider.QueryStatus(session.TelrRef)
+		if err != nil {
+			fmt.Println("Status query failed for session:", session.Reference, "error:", err)
+			continue
+		}
+
+		done, settleErr, err := reconcileSession(db, session.ID, result)
+		if err != nil {
+			fmt.Println("Failed to reconcile session:", session.Reference, "error:", err)
+			continue
+		}
+		if settleErr != "" {
+			fmt.Println("Paid session could not be settled:", session.Reference, "error:", settleErr)
+			failed++
+		}
+		if done {
+			resolved++
+		}
+	}
+	return resolved, failed, nil
+}
+
+// reconcileSession applies a provider status result to a still-pending session.
+// When a paid session can't be settled it is left failed or errored for review,
+// and settleErr says why.
+func reconcileSession(db *gorm.DB, sessionID uint, result *payment.StatusResult) (done bool, settleErr string, err error) {
+	var placed *orderControllers.PlacedOrder
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Lock the session so a late webhook can't settle it at the same time
+		var session models.PaymentSession
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, sessionID).Error; err != nil {
+			return err
+		}
+		if session.Status != models.PaymentSessionPending || session.OrderID != nil {
+			return nil
+		}
+
+		message := "reconciled: " + result.Message
+		switch result.Status {
+		case payment.StatusApproved:
+			session.TranRef = result.TranRef
+			code, body, order := settlePaidSession(tx, &session, result.Amount, result.Currency, message)
+			placed = order
+			if code != http.StatusOK {
+				settleErr = fmt.Sprint(body["error"])
+				if details, ok := body["details"]; ok {
+					settleErr += ": " + fmt.Sprint(details)
+				}
+				// settlePaidSession finalises the session on failure; make sure it never stays pending
+				if session.Status == models.PaymentSessionPending {
+					completeSession(tx, &session, models.PaymentSessionFailed, message+", not settled: "+settleErr)
+				}
+			}
+		case payment.StatusExpired, payment.StatusDeclined:
+			completeSession(tx, &session, models.PaymentSessionFailed, message)
+		case payment.StatusCancelled:
+			completeSession(tx, &session, models.PaymentSessionCancelled, message)
+		default:
+			// Customer may still be on the payment page: try again on the next run
+			return nil
+		}
+		done = true
+		return nil
+	})
+	if err == nil && placed != nil {
+		placed.Announce()
+	}
+	return done, settleErr, err
+}
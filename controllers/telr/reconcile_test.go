@@ -0,0 +1,49 @@
+package telrControllers
+
+import (
+	"testing"
+
+	"github.com/junaidrashid-git/ecommerce-api/internal/testdb"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"github.com/junaidrashid-git/ecommerce-api/payment"
+)
+
+func TestReconcileCountsUnsettledPayments(t *testing.T) {
+	db := testdb.Open(t)
+	seedCart(t, db)
+	provider := &fakeProvider{}
+	r := newRouter(db, provider)
+	session := checkout(t, db, r)
+
+	// The gateway captured a different amount than was checked out
+	provider.status = &payment.StatusResult{Status: payment.StatusApproved, TranRef: "T600", Amount: "1.00", Currency: session.Currency}
+	resolved, failed, err := ReconcilePendingPayments(db, provider, 0)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if resolved != 1 || failed != 1 {
+		t.Errorf("resolved %d failed %d, want 1 and 1", resolved, failed)
+	}
+	db.First(&session, session.ID)
+	if session.Status != models.PaymentSessionFailed || session.OrderID != nil {
+		t.Errorf("session status %q order %v, want failed without an order", session.Status, session.OrderID)
+	}
+}
+
+func TestReconcilePlacesPaidOrder(t *testing.T) {
+	db := testdb.Open(t)
+	seedCart(t, db)
+	provider := &fakeProvider{}
+	r := newRouter(db, provider)
+	session := checkout(t, db, r)
+
+	provider.status = &payment.StatusResult{Status: payment.StatusApproved, TranRef: "T700", Amount: "130.00", Currency: session.Currency}
+	resolved, failed, err := ReconcilePendingPayments(db, provider, 0)
+	if err != nil || resolved != 1 || failed != 0 {
+		t.Fatalf("reconcile: resolved %d failed %d err %v, want 1, 0, nil", resolved, failed, err)
+	}
+	db.First(&session, session.ID)
+	if session.Status != models.PaymentSessionPaid || session.OrderID == nil || session.TranRef != "T700" {
+		t.Errorf("session status %q order %v tran_ref %q", session.Status, session.OrderID, session.TranRef)
+	}
+}
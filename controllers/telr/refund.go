@@ -0,0 +1,260 @@
+package telrControllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	orderControllers "github.com/junaidrashid-git/ecommerce-api/controllers/order"
+	"github.com/junaidrashid-git/ecommerce-api/middleware"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"github.com/junaidrashid-git/ecommerce-api/payment"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RefundOrderRequest selects what to refund. Send either amount or items;
+// an empty body refunds everything not yet refunded.
+type RefundOrderRequest struct {
+	Amount *float64 `json:"amount"`
+	Items  []struct {
+		OrderItemID uint `json:"order_item_id" binding:"required"`
+		Quantity    int  `json:"quantity" binding:"required,min=1"`
+	} `json:"items"`
+	Reason string `json:"reason"`
+}
+
+// RefundOrderHandler issues a full or partial refund for a card-paid order.
+// POST /admin/orders/:orderID/refunds
+func RefundOrderHandler(db *gorm.DB, provider payment.PaymentProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID := c.Param("orderID")
+
+		var req RefundOrderRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if req.Amount != nil && len(req.Items) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "send either amount or items, not both"})
+			return
+		}
+
+		// 1️⃣ Reserve the refund amount under a lock on the order
+		var refund models.Refund
+		var session models.PaymentSession
+		status := http.StatusInternalServerError
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var order models.Order
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").
+				First(&order, "id = ?", orderID).Error; err != nil {
+				status = http.StatusNotFound
+				return errors.New("order not found")
+			}
+
+			if err := tx.Where("order_id = ? AND status = ?", order.ID, models.PaymentSessionPaid).
+				First(&session).Error; err != nil || session.TranRef == "" {
+				status = http.StatusBadRequest
+				return errors.New("order was not paid by card")
+			}
+
+			var refunded float64
+			if err := tx.Model(&models.Refund{}).
+				Where("order_id = ? AND status IN ?", order.ID, []models.RefundStatus{models.RefundStatusPending, models.RefundStatusCompleted}).
+				Select("COALESCE(SUM(amount), 0)").Scan(&refunded).Error; err != nil {
+				return err
+			}
+			remaining := orderControllers.RoundMoney(order.TotalAmount - refunded)
+
+			refund = models.Refund{
+				OrderID:   order.ID,
+				Currency:  session.Currency,
+				Reason:    req.Reason,
+				Status:    models.RefundStatusPending,
+				TranRef:   session.TranRef,
+				CreatedBy: middleware.Actor(c),
+			}
+
+			switch {
+			case len(req.Items) > 0:
+				items, amount, err := refundItems(tx, order, req)
+				if err != nil {
+					status = http.StatusBadRequest
+					return err
+				}
+				refund.Items = items
+				// Line rounding must never return more than was captured
+				refund.Amount = math.Min(amount, remaining)
+			case req.Amount != nil:
+				refund.Amount = orderControllers.RoundMoney(*req.Amount)
+			default:
+				refund.Amount = remaining
+			}
+
+			if refund.Amount <= 0 {
+				status = http.StatusBadRequest
+				return errors.New("nothing to refund")
+			}
+			if refund.Amount > remaining {
+				status = http.StatusBadRequest
+				return fmt.Errorf("refund exceeds refundable amount of %.2f", remaining)
+			}
+
+			return tx.Create(&refund).Error
+		})
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 2️⃣ Ask the gateway to move the money
+		result, err := provider.Refund(payment.RefundRequest{
+			TranRef:     refund.TranRef,
+			Reference:   session.Reference,
+			Amount:      refund.Amount,
+			Currency:    refund.Currency,
+			Description: "Refund for order " + orderID,
+		})
+		if err != nil || !result.Approved {
+			var message string
+			if err != nil {
+				message = err.Error()
+			} else {
+				message = result.Message
+			}
+			db.Model(&refund).Updates(map[string]interface{}{
+				"status":          models.RefundStatusFailed,
+				"gateway_message": message,
+			})
+			c.JSON(http.StatusBadGateway, gin.H{"error": "refund rejected by gateway", "details": message, "refund_id": refund.ID})
+			return
+		}
+
+		// 3️⃣ Gateway confirmed: complete the refund and flip the payment status
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&refund).Updates(map[string]interface{}{
+				"status":          models.RefundStatusCompleted,
+				"refund_ref":      result.RefundRef,
+				"gateway_message": result.Message,
+			}).Error; err != nil {
+				return err
+			}
+
+			var order models.Order
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, refund.OrderID).Error; err != nil {
+				return err
+			}
+
+			var refunded float64
+			if err := tx.Model(&models.Refund{}).
+				Where("order_id = ? AND status = ?", order.ID, models.RefundStatusCompleted).
+				Select("COALESCE(SUM(amount), 0)").Scan(&refunded).Error; err != nil {
+				return err
+			}
+
+			paymentStatus := models.PaymentStatusPartiallyRefunded
+			if orderControllers.RoundMoney(order.TotalAmount-refunded) <= 0 {
+				paymentStatus = models.PaymentStatusRefunded
+			}
+			return tx.Model(&order).Update("payment_status", paymentStatus).Error
+		})
+		if err != nil {
+			fmt.Println("Refund", refund.ID, "confirmed by gateway but failed to save:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "refund confirmed but failed to update order", "refund_id": refund.ID})
+			return
+		}
+
+		db.Preload("Items").First(&refund, refund.ID)
+		c.JSON(http.StatusOK, refund)
+	}
+}
+
+// refundItems prices the requested order lines at what the customer paid for them,
+// refusing quantities already refunded. The order's coupon discount is spread over
+// its lines in proportion to their value.
+func refundItems(tx *gorm.DB, order models.Order, req RefundOrderRequest) ([]models.RefundItem, float64, error) {
+	lines := make(map[uint]models.OrderItem, len(order.Items))
+	var subtotal float64
+	for _, item := range order.Items {
+		lines[item.ID] = item
+		subtotal += item.ProductSalePrice * float64(item.Quantity)
+	}
+
+	goodsDiscount, err := orderGoodsDiscount(tx, order, subtotal)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var items []models.RefundItem
+	var total float64
+	for _, requested := range req.Items {
+		line, ok := lines[requested.OrderItemID]
+		if !ok {
+			return nil, 0, fmt.Errorf("order item %d does not belong to this order", requested.OrderItemID)
+		}
+
+		var alreadyRefunded int64
+		if err := tx.Model(&models.RefundItem{}).
+			Joins("JOIN refunds ON refunds.id = refund_items.refund_id").
+			Where("refund_items.order_item_id = ? AND refunds.status IN ?", line.ID,
+				[]models.RefundStatus{models.RefundStatusPending, models.RefundStatusCompleted}).
+			Select("COALESCE(SUM(refund_items.quantity), 0)").Scan(&alreadyRefunded).Error; err != nil {
+			return nil, 0, err
+		}
+		if int64(requested.Quantity) > int64(line.Quantity)-alreadyRefunded {
+			return nil, 0, fmt.Errorf("cannot refund %d of %s: only %d left to refund",
+				requested.Quantity, line.ProductEName, int64(line.Quantity)-alreadyRefunded)
+		}
+
+		lineValue := line.ProductSalePrice * float64(line.Quantity)
+		paidUnitPrice := line.ProductSalePrice
+		if goodsDiscount > 0 && subtotal > 0 {
+			paidUnitPrice -= goodsDiscount * lineValue / subtotal / float64(line.Quantity)
+		}
+		amount := orderControllers.RoundMoney(paidUnitPrice * float64(requested.Quantity))
+		items = append(items, models.RefundItem{
+			OrderItemID: line.ID,
+			Quantity:    requested.Quantity,
+			Amount:      amount,
+		})
+		total += amount
+	}
+	return items, orderControllers.RoundMoney(total), nil
+}
+
+// orderGoodsDiscount is the part of the order's discount taken off its items.
+// Free-shipping coupons discount the shipping instead, so none of it is.
+func orderGoodsDiscount(tx *gorm.DB, order models.Order, subtotal float64) (float64, error) {
+	if order.Discount <= 0 {
+		return 0, nil
+	}
+
+	var coupon models.Coupon
+	err := tx.Select("type").Where("code = ?", order.CouponCode).First(&coupon).Error
+	switch {
+	case err == nil && coupon.Type == models.CouponFreeShipping:
+		return 0, nil
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		return 0, err
+	}
+	// Unknown coupons are assumed to discount the items, which refunds less
+	return math.Min(order.Discount, subtotal), nil
+}
+
+// GetOrderRefunds lists the refunds recorded against an order.
+// GET /admin/orders/:orderID/refunds
+func GetOrderRefunds(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var refunds []models.Refund
+		if err := db.Preload("Items").Where("order_id = ?", c.Param("orderID")).
+			Order("created_at DESC").Find(&refunds).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refunds"})
+			return
+		}
+		c.JSON(http.StatusOK, refunds)
+	}
+}
@@ -0,0 +1,94 @@
+package telrControllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/junaidrashid-git/ecommerce-api/internal/testdb"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"github.com/junaidrashid-git/ecommerce-api/payment"
+)
+
+func TestRefundOrder(t *testing.T) {
+	db := testdb.Open(t)
+	seedCart(t, db)
+	provider := &fakeProvider{}
+	r := newRouter(db, provider)
+	session := checkout(t, db, r)
+	if w := webhook(r, session, "T400", payment.StatusApproved, "130.00"); w.Code != http.StatusOK {
+		t.Fatalf("webhook: %d %s", w.Code, w.Body.String())
+	}
+	var order models.Order
+	if err := db.Preload("Items").Where("user_id = ?", testUserID).First(&order).Error; err != nil {
+		t.Fatalf("load order: %v", err)
+	}
+
+	refund := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/orders/%d/refunds", order.ID), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serve(r, req)
+	}
+
+	// One of the two units
+	w := refund(fmt.Sprintf(`{"items":[{"order_item_id":%d,"quantity":1}]}`, order.Items[0].ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("item refund: %d %s", w.Code, w.Body.String())
+	}
+	if len(provider.refunds) != 1 || provider.refunds[0].Amount != 50 || provider.refunds[0].TranRef != "T400" {
+		t.Errorf("provider got %+v, want 50.00 against T400", provider.refunds)
+	}
+	db.First(&order, order.ID)
+	if order.PaymentStatus != models.PaymentStatusPartiallyRefunded {
+		t.Errorf("payment status %q, want partially refunded", order.PaymentStatus)
+	}
+
+	// More than is left
+	if w := refund(`{"amount":100}`); w.Code != http.StatusBadRequest {
+		t.Errorf("over-refund: %d %s, want 400", w.Code, w.Body.String())
+	}
+
+	// The rest
+	w = refund("")
+	if w.Code != http.StatusOK {
+		t.Fatalf("full refund: %d %s", w.Code, w.Body.String())
+	}
+	var completed models.Refund
+	json.Unmarshal(w.Body.Bytes(), &completed)
+	if completed.Amount != 80 || completed.Status != models.RefundStatusCompleted {
+		t.Errorf("refund %.2f %q, want 80.00 completed", completed.Amount, completed.Status)
+	}
+	db.First(&order, order.ID)
+	if order.PaymentStatus != models.PaymentStatusRefunded {
+		t.Errorf("payment status %q, want refunded", order.PaymentStatus)
+	}
+}
+
+func TestRefundRejectedByGateway(t *testing.T) {
+	db := testdb.Open(t)
+	seedCart(t, db)
+	provider := &fakeProvider{}
+	r := newRouter(db, provider)
+	session := checkout(t, db, r)
+	if w := webhook(r, session, "T500", payment.StatusApproved, "130.00"); w.Code != http.StatusOK {
+		t.Fatalf("webhook: %d %s", w.Code, w.Body.String())
+	}
+	var order models.Order
+	db.Where("user_id = ?", testUserID).First(&order)
+
+	provider.decline = true
+	w := serve(r, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/orders/%d/refunds", order.ID), nil))
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("refund: %d %s, want 502", w.Code, w.Body.String())
+	}
+
+	var refund models.Refund
+	db.Where("order_id = ?", order.ID).First(&refund)
+	db.First(&order, order.ID)
+	if refund.Status != models.RefundStatusFailed || order.PaymentStatus != models.PaymentStatusPaid {
+		t.Errorf("refund %q, order payment %q; want failed and still paid", refund.Status, order.PaymentStatus)
+	}
+}
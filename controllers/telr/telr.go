@@ -1,229 +1,434 @@
 package telrControllers
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	orderControllers "github.com/junaidrashid-git/ecommerce-api/controllers/order"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"github.com/junaidrashid-git/ecommerce-api/payment"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// TelrPaymentResponse represents Telr response
-type TelrPaymentResponse struct {
-	Order struct {
-		Ref string `json:"ref"`
-		URL string `json:"url"`
-	} `json:"order"`
-	Error *struct {
-		Code    string `json:"code"`
-		Message string `json:"message"`
-	} `json:"error,omitempty"`
-}
+// checkoutCurrency is the currency every checkout is priced and charged in
+const checkoutCurrency = "AED"
 
-// getTelrConfig picks production endpoint, test mode if needed
-func getTelrConfig() (storeID int, authKey, apiURL string, testMode int, err error) {
-	storeID, _ = strconv.Atoi(os.Getenv("TELR_STORE_ID_PROD"))
-	authKey = os.Getenv("TELR_AUTH_KEY_PROD")
-	apiURL = os.Getenv("TELR_API_URL_PROD")
-	testMode = 0
+// PaymentRequestHandler prices the authenticated user's cart on the server,
+// stores a PaymentSession and opens a payment with the provider for that amount.
+func PaymentRequestHandler(db *gorm.DB, provider payment.PaymentProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDVal, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		userID, _ := userIDVal.(string)
 
-	mode := os.Getenv("TELR_MODE")
-	if mode == "sandbox" || mode == "dev" {
-		testMode = 1 // use test mode even on live endpoint
-	}
+		// Customer details are optional and default to the user's profile
+		var input struct {
+			Description  string `json:"description"`
+			Name         string `json:"name"`
+			Email        string `json:"email" binding:"omitempty,email"`
+			Phone        string `json:"phone"`
+			AddressLine1 string `json:"address_line1"`
+			AddressLine2 string `json:"address_line2"`
+			City         string `json:"city"`
+			Region       string `json:"region"`
+			Country      string `json:"country"`
+			Postcode     string `json:"postcode"`
+		}
 
-	if storeID == 0 || authKey == "" || apiURL == "" {
-		return 0, "", "", 0, fmt.Errorf("telr configuration missing")
-	}
-	return storeID, authKey, apiURL, testMode, nil
-}
+		// An empty body is fine: every field is optional
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request", "details": err.Error()})
+			return
+		}
 
-// CreateTelrPayment sends request to Telr and returns payment URL & order reference
-func CreateTelrPayment(cartID, amount, currency, description, name, email, phone, addressLine1, addressLine2, city, region, country, postcode string) (string, string, error) {
-	storeID, authKey, apiURL, testMode, err := getTelrConfig()
-	if err != nil {
-		return "", "", err
-	}
+		var user models.User
+		if err := db.First(&user, "id = ?", userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
 
-	payload := map[string]interface{}{
-		"method":  "create",
-		"store":   storeID,
-		"authkey": authKey,
-		"order": map[string]interface{}{
-			"cartid":      cartID,
-			"test":        testMode,
-			"amount":      amount,
-			"currency":    currency,
-			"description": description,
-		},
-		"customer": map[string]interface{}{
-			"name":  name,
-			"email": email,
-			"phone": phone,
-			"address": map[string]string{
-				"line1":    addressLine1,
-				"line2":    addressLine2,
-				"city":     city,
-				"region":   region,
-				"country":  country,
-				"postcode": postcode,
-			},
-		},
-		"return": map[string]string{
-			"authorised": os.Getenv("TELR_SUCCESS_URL"),
-			"declined":   os.Getenv("TELR_FAILURE_URL"),
-			"cancelled":  os.Getenv("TELR_CANCEL_URL"),
-		},
-	}
+		var cart models.Cart
+		if err := db.Where("user_id = ?", userID).First(&cart).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User cart not found"})
+			return
+		}
 
-	jsonData, _ := json.Marshal(payload)
-	fmt.Println("Telr Payload:", string(jsonData)) // debug log
+		// One payment per cart: a second would release the first one's stock
+		// and could charge the customer twice
+		if err := orderControllers.CheckNoPendingPayment(db, cart.CartID); err != nil {
+			checkoutConflict(c, err)
+			return
+		}
 
-	req, _ := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
+		// The customer must see any price or stock changes before paying
+		items, err := orderControllers.RefreshCartForCheckout(db, cart.CartID)
+		if err != nil {
+			var changed orderControllers.CartChangedError
+			if errors.As(err, &changed) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "changes": changed.Changes})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		cart.Items = items
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to reach Telr: %v", err)
-	}
-	defer resp.Body.Close()
+		// Price the cart from live product rows; client amounts are never trusted
+		totals, err := orderControllers.PriceCart(db, cart, user.Address)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("telr API error (%d): %s", resp.StatusCode, string(body))
-	}
+		// Snapshot the priced lines: the order is placed from them once paid
+		sessionItems := make([]models.PaymentSessionItem, 0, len(totals.Items))
+		for _, line := range totals.Items {
+			sessionItems = append(sessionItems, models.PaymentSessionItem{
+				ProductID:     line.ProductID,
+				ProductEName:  line.ProductEName,
+				ProductArName: line.ProductArName,
+				ProductImage:  line.ProductImage,
+				UnitPrice:     line.UnitPrice,
+				RegularPrice:  line.RegularPrice,
+				Weight:        line.Weight / float64(line.Quantity),
+				Quantity:      line.Quantity,
+			})
+		}
 
-	var telrResp TelrPaymentResponse
-	if err := json.Unmarshal(body, &telrResp); err != nil {
-		return "", "", fmt.Errorf("failed to parse Telr response: %v", err)
-	}
+		session := models.PaymentSession{
+			CartID:       cart.CartID,
+			UserID:       userID,
+			Subtotal:     totals.Subtotal,
+			ShippingCost: totals.ShippingCost,
+			CouponCode:   cart.CouponCode,
+			Discount:     totals.Discount,
+			Amount:       totals.Total,
+			Currency:     checkoutCurrency,
+			Provider:     provider.Name(),
+			Status:       models.PaymentSessionPending,
+			Items:        sessionItems,
+		}
+		status := http.StatusInternalServerError
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Lock the cart so concurrent checkouts can't both open a payment
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Cart{}, cart.CartID).Error; err != nil {
+				return errors.New("Failed to create payment session")
+			}
+			if err := orderControllers.CheckNoPendingPayment(tx, cart.CartID); err != nil {
+				if errors.Is(err, orderControllers.ErrCheckoutInProgress) {
+					status = http.StatusConflict
+					return err
+				}
+				return errors.New("Failed to create payment session")
+			}
 
-	if telrResp.Error != nil {
-		return "", "", fmt.Errorf("telr error: %s", telrResp.Error.Message)
-	}
+			if err := tx.Create(&session).Error; err != nil {
+				return errors.New("Failed to create payment session")
+			}
 
-	if telrResp.Order.URL == "" {
-		return "", "", fmt.Errorf("telr returned empty payment URL")
-	}
+			// Gateways need a unique reference per payment attempt
+			session.Reference = fmt.Sprintf("%d-%d", cart.CartID, session.ID)
+			if err := tx.Model(&session).Update("reference", session.Reference).Error; err != nil {
+				return errors.New("Failed to create payment session")
+			}
 
-	return telrResp.Order.URL, telrResp.Order.Ref, nil
-}
+			// Hold the stock until the payment completes or the reservation expires
+			if err := orderControllers.ReserveCartStock(tx, cart.CartID, session.ID, cart.Items, orderControllers.ReservationTTL()); err != nil {
+				status = http.StatusConflict
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		if input.Description == "" {
+			input.Description = "Order " + session.Reference
+		}
 
-// PaymentRequestHandler is the Gin handler
-func PaymentRequestHandler(c *gin.Context) {
-	var input struct {
-		CartID      string `json:"cartid" binding:"required"`
-		Amount      string `json:"amount" binding:"required"`
-		Currency    string `json:"currency" binding:"required"`
-		Description string `json:"description" binding:"required"`
-		Name        string `json:"name" binding:"required"`
-		Email       string `json:"email" binding:"required,email"`
-		Phone       string `json:"phone" binding:"required"`
-		// Optional: pass address from frontend
-		AddressLine1 string `json:"address_line1"`
-		AddressLine2 string `json:"address_line2"`
-		City         string `json:"city"`
-		Region       string `json:"region"`
-		Country      string `json:"country"`
-		Postcode     string `json:"postcode"`
+		result, err := provider.CreatePayment(payment.CreateRequest{
+			Reference:   session.Reference,
+			Amount:      session.Amount,
+			Currency:    session.Currency,
+			Description: input.Description,
+			Customer: payment.Customer{
+				Name:  firstNonEmpty(input.Name, user.Name),
+				Email: firstNonEmpty(input.Email, user.Email),
+				Phone: firstNonEmpty(input.Phone, user.Phone),
+				Address: payment.Address{
+					Line1:    firstNonEmpty(input.AddressLine1, user.Address.Street),
+					Line2:    input.AddressLine2,
+					City:     firstNonEmpty(input.City, user.Address.City),
+					Region:   firstNonEmpty(input.Region, user.Address.State),
+					Country:  firstNonEmpty(input.Country, user.Address.Country),
+					Postcode: firstNonEmpty(input.Postcode, user.Address.PostalCode),
+				},
+			},
+		})
+
+		if err != nil {
+			completeSession(db, &session, models.PaymentSessionFailed, err.Error())
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		session.TelrRef = result.ProviderRef
+		if err := db.Model(&session).Update("telr_ref", result.ProviderRef).Error; err != nil {
+			fmt.Println("Failed to store provider ref for session:", session.Reference, "error:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"payment_url":   result.PaymentURL,
+			"order_ref":     result.ProviderRef,
+			"cartid":        session.Reference,
+			"subtotal":      session.Subtotal,
+			"shipping_cost": session.ShippingCost,
+			"discount":      session.Discount,
+			"amount":        session.Amount,
+			"currency":      session.Currency,
+		})
 	}
+}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(400, gin.H{"error": "invalid request", "details": err.Error()})
+// checkoutConflict answers 409 while the cart's payment is in flight
+func checkoutConflict(c *gin.Context, err error) {
+	if errors.Is(err, orderControllers.ErrCheckoutInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check cart payment"})
+}
 
-	fmt.Println("Incoming payment request:", input)
-
-	paymentURL, orderRef, err := CreateTelrPayment(
-		input.CartID,
-		input.Amount,
-		input.Currency,
-		input.Description,
-		input.Name,
-		input.Email,
-		input.Phone,
-		input.AddressLine1,
-		input.AddressLine2,
-		input.City,
-		input.Region,
-		input.Country,
-		input.Postcode,
-	)
+// firstNonEmpty returns the first non-blank value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
 
-	if err != nil {
-		c.JSON(502, gin.H{"error": err.Error()})
-		return
+// completeSession moves a payment session to a final status
+func completeSession(db *gorm.DB, session *models.PaymentSession, status models.PaymentSessionStatus, message string) {
+	now := time.Now()
+	session.Status = status
+	session.StatusMessage = message
+	session.CompletedAt = &now
+	if err := db.Model(session).Updates(map[string]interface{}{
+		"status":         status,
+		"status_message": message,
+		"order_id":       session.OrderID,
+		"tran_ref":       session.TranRef,
+		"completed_at":   now,
+	}).Error; err != nil {
+		fmt.Println("Failed to update payment session:", session.Reference, "error:", err)
 	}
 
-	c.JSON(200, gin.H{
-		"payment_url": paymentURL,
-		"order_ref":   orderRef,
-	})
+	// A session that won't become an order gives its stock back
+	if status != models.PaymentSessionPaid {
+		if err := orderControllers.ReleaseSessionReservations(db, session.ID); err != nil {
+			fmt.Println("Failed to release stock for session:", session.Reference, "error:", err)
+		}
+	}
 }
 
-type TelrWebhookRequest struct {
-	Order struct {
-		Ref      string `json:"ref"`
-		CartID   string `json:"cartid"`
-		Amount   string `json:"amount"`
-		Currency string `json:"currency"`
-		Status   struct {
-			Code int    `json:"code"` // 3 = Paid, 6 = Failed, etc.
-			Text string `json:"text"`
-		} `json:"status"`
-		Customer struct {
-			Name    string `json:"name"`
-			Email   string `json:"email"`
-			Phone   string `json:"phone"`
-			Address struct {
-				Line1    string `json:"line1"`
-				Line2    string `json:"line2"`
-				City     string `json:"city"`
-				Region   string `json:"region"`
-				Country  string `json:"country"`
-				Postcode string `json:"postcode"`
-			} `json:"address"`
-		} `json:"customer"`
-	} `json:"order"`
+// amountMatches compares a gateway amount string with the stored session amount
+func amountMatches(tranAmount string, expected float64) bool {
+	paid, err := strconv.ParseFloat(strings.TrimSpace(tranAmount), 64)
+	if err != nil {
+		return false
+	}
+	return math.Abs(orderControllers.RoundMoney(paid)-orderControllers.RoundMoney(expected)) < 0.005
 }
 
-func TelrWebhookHandler(db *gorm.DB) gin.HandlerFunc {
+// TelrWebhookHandler processes payment notifications verified by the provider.
+// Deliveries are deduplicated by tran_ref: the first outcome is stored and replayed on retries.
+// Server errors are rolled back rather than stored, so retries are processed afresh.
+func TelrWebhookHandler(db *gorm.DB, provider payment.PaymentProvider) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := c.Request.ParseForm(); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse form"})
+		notification, err := provider.VerifyWebhook(c.Request)
+		if err != nil {
+			fmt.Println("Rejected", provider.Name(), "webhook:", err)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 			return
 		}
 
-		fmt.Println("Received Telr webhook form:", c.Request.PostForm)
+		// The form carries customer and card details: log only what identifies the delivery
+		fmt.Println("Received", provider.Name(), "webhook: tran_ref", notification.TranRef,
+			"tran_cartid", notification.Reference, "status", notification.Status)
 
-		cartID := c.PostForm("tran_cartid")
-		tranStatus := c.PostForm("tran_status") // "A" = approved
-
-		if cartID == "" {
+		if notification.Reference == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "missing tran_cartid"})
 			return
 		}
-
-		if tranStatus != "A" {
-			c.JSON(http.StatusOK, gin.H{"message": "Payment not successful"})
+		if notification.TranRef == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing tran_ref"})
 			return
 		}
 
-		if err := orderControllers.PlaceOrder(db, cartID, "confirmed", "paid"); err != nil {
-			fmt.Println("Failed to place order for cart:", cartID, "error:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to place order", "details": err.Error()})
+		var event models.PaymentWebhookEvent
+		var placed *orderControllers.PlacedOrder
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Lock the session so concurrent deliveries for the same cart are serialized
+			var session models.PaymentSession
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("reference = ?", notification.Reference).First(&session).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					fmt.Println("No payment session found for reference:", notification.Reference)
+					event = models.PaymentWebhookEvent{ResponseCode: http.StatusBadRequest}
+					event.ResponseBody = encodeBody(gin.H{"error": "unknown tran_cartid"})
+					return nil
+				}
+				return err
+			}
+
+			// Retry of a delivery we already handled: replay the stored outcome
+			if err := tx.Where("tran_ref = ?", notification.TranRef).First(&event).Error; err == nil {
+				fmt.Println("Replaying stored outcome for tran_ref:", notification.TranRef)
+				return nil
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			code, body, order := processWebhook(tx, notification, &session)
+			// Don't record server errors: roll back so the gateway's retry of
+			// this delivery is processed again instead of replaying the failure
+			if code >= http.StatusInternalServerError {
+				return fmt.Errorf("%d %s", code, encodeBody(body))
+			}
+			placed = order
+			event = models.PaymentWebhookEvent{
+				TranRef:      notification.TranRef,
+				Reference:    notification.Reference,
+				TranStatus:   string(notification.Status),
+				ResponseCode: code,
+				ResponseBody: encodeBody(body),
+			}
+			// Held transactions get a final notification with the same tran_ref later
+			if notification.Status == payment.StatusHeld {
+				return nil
+			}
+			return tx.Create(&event).Error
+		})
+		if err != nil {
+			fmt.Println("Failed to process webhook:", notification.TranRef, "error:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process webhook"})
 			return
 		}
+		if placed != nil {
+			placed.Announce()
+		}
+
+		c.Data(event.ResponseCode, "application/json; charset=utf-8", []byte(event.ResponseBody))
+	}
+}
+
+// processWebhook applies a first-time webhook delivery to its payment session
+// and returns the response to send (and store) for it, and the order placed if any.
+func processWebhook(tx *gorm.DB, notification *payment.Notification, session *models.PaymentSession) (int, gin.H, *orderControllers.PlacedOrder) {
+	session.TranRef = notification.TranRef
+
+	// An order was already placed for this session by an earlier transaction
+	if session.OrderID != nil {
+		return http.StatusOK, gin.H{"message": "Order already placed", "order_id": *session.OrderID}, nil
+	}
+
+	switch notification.Status {
+	case payment.StatusApproved:
+		return settlePaidSession(tx, session, notification.Amount, notification.Currency, notification.Message)
+	case payment.StatusHeld:
+		// On hold: the gateway will send the final status later
+		if err := tx.Model(session).Updates(map[string]interface{}{
+			"tran_ref":       session.TranRef,
+			"status_message": notification.Message,
+		}).Error; err != nil {
+			fmt.Println("Failed to record held payment for session:", session.Reference, "error:", err)
+			return http.StatusInternalServerError, gin.H{"error": "failed to record held payment"}, nil
+		}
+		return http.StatusOK, gin.H{"message": "Payment on hold"}, nil
+	case payment.StatusCancelled:
+		completeSession(tx, session, models.PaymentSessionCancelled, notification.Message)
+		return http.StatusOK, gin.H{"message": "Payment not successful"}, nil
+	default:
+		completeSession(tx, session, models.PaymentSessionFailed, notification.Message)
+		return http.StatusOK, gin.H{"message": "Payment not successful"}, nil
+	}
+}
+
+// settlePaidSession verifies the paid amount against the session and places its order.
+// Used by both the webhook and the reconciler, which announce the order once committed.
+func settlePaidSession(tx *gorm.DB, session *models.PaymentSession, paidAmount, paidCurrency, message string) (int, gin.H, *orderControllers.PlacedOrder) {
+	// The paid amount must match what the server priced at checkout
+	if !amountMatches(paidAmount, session.Amount) || !strings.EqualFold(paidCurrency, session.Currency) {
+		mismatch := fmt.Sprintf("amount mismatch: paid %s %s, expected %.2f %s",
+			paidAmount, paidCurrency, session.Amount, session.Currency)
+		fmt.Println("Payment", mismatch, "for session:", session.Reference)
+		completeSession(tx, session, models.PaymentSessionFailed, mismatch)
+		return http.StatusBadRequest, gin.H{"error": "tran_amount does not match checkout"}, nil
+	}
+
+	placed, err := placeSessionOrder(tx, session)
+	if err != nil {
+		fmt.Println("Failed to place order for session:", session.Reference, "error:", err)
+		completeSession(tx, session, models.PaymentSessionError, "order placement failed, needs review: "+err.Error())
+		return http.StatusInternalServerError, gin.H{"error": "failed to place order", "details": err.Error()}, nil
+	}
+
+	session.OrderID = &placed.Order.ID
+	completeSession(tx, session, models.PaymentSessionPaid, message)
+	return http.StatusOK, gin.H{"message": "Order placed successfully", "order_id": placed.Order.ID}, placed
+}
+
+// placeSessionOrder places the order a paid session was priced for at checkout.
+// Sessions opened before line items were stored fall back to the cart, and the
+// order is only kept if it comes to exactly the amount paid.
+func placeSessionOrder(tx *gorm.DB, session *models.PaymentSession) (*orderControllers.PlacedOrder, error) {
+	if err := tx.Model(session).Association("Items").Find(&session.Items); err != nil {
+		return nil, err
+	}
+	if len(session.Items) > 0 {
+		return orderControllers.PlaceSessionOrder(tx, session, "confirmed", "paid", models.PaymentMethodCard)
+	}
+
+	var placed *orderControllers.PlacedOrder
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cartID := strconv.FormatUint(uint64(session.CartID), 10)
+		placed, err = orderControllers.PlaceOrder(tx, cartID, "confirmed", "paid", models.PaymentMethodCard)
+		if err != nil {
+			return err
+		}
+		if orderControllers.RoundMoney(placed.Order.TotalAmount) != orderControllers.RoundMoney(session.Amount) {
+			return fmt.Errorf("cart now totals %.2f, paid %.2f", placed.Order.TotalAmount, session.Amount)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return placed, nil
+}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Order placed successfully"})
+// encodeBody marshals a response body for storage
+func encodeBody(body gin.H) string {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "{}"
 	}
+	return string(data)
 }
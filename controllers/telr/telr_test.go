@@ -0,0 +1,325 @@
+package telrControllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/internal/testdb"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"github.com/junaidrashid-git/ecommerce-api/payment"
+	"gorm.io/gorm"
+)
+
+const testUserID = "telr-test-user"
+
+// fakeProvider is a PaymentProvider that records requests instead of calling a gateway.
+// Webhooks are plain forms: tran_cartid, tran_ref, status, tran_amount and tran_currency.
+type fakeProvider struct {
+	created []payment.CreateRequest
+	refunds []payment.RefundRequest
+	status  *payment.StatusResult
+	decline bool // reject refunds
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) CreatePayment(req payment.CreateRequest) (*payment.CreateResult, error) {
+	p.created = append(p.created, req)
+	return &payment.CreateResult{
+		PaymentURL:  "https://pay.example.com/" + req.Reference,
+		ProviderRef: "ref-" + req.Reference,
+	}, nil
+}
+
+func (p *fakeProvider) VerifyWebhook(r *http.Request) (*payment.Notification, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	return &payment.Notification{
+		Reference: r.PostFormValue("tran_cartid"),
+		TranRef:   r.PostFormValue("tran_ref"),
+		Status:    payment.Status(r.PostFormValue("status")),
+		Amount:    r.PostFormValue("tran_amount"),
+		Currency:  r.PostFormValue("tran_currency"),
+	}, nil
+}
+
+func (p *fakeProvider) QueryStatus(providerRef string) (*payment.StatusResult, error) {
+	if p.status == nil {
+		return &payment.StatusResult{Status: payment.StatusPending}, nil
+	}
+	return p.status, nil
+}
+
+func (p *fakeProvider) Refund(req payment.RefundRequest) (*payment.RefundResult, error) {
+	p.refunds = append(p.refunds, req)
+	if p.decline {
+		return &payment.RefundResult{Message: "declined"}, nil
+	}
+	return &payment.RefundResult{Approved: true, RefundRef: fmt.Sprintf("rf-%d", len(p.refunds))}, nil
+}
+
+// seedCart creates a user whose cart holds 2 units of a 50.00 product weighing 1kg
+func seedCart(t *testing.T, db *gorm.DB) models.Product {
+	t.Helper()
+	product := models.Product{EName: "Pan", SalePrice: 50, RegularPrice: 60, Image: "/pan.png", Weight: 1, Stock: 10}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	user := models.User{ID: testUserID, Email: "telr-test@example.com", Name: "Test"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	cart := models.Cart{UserID: testUserID, Items: []models.CartItem{{
+		ProductID:           product.ID,
+		ProductEName:        product.EName,
+		ProductImage:        product.Image,
+		ProductStock:        product.Stock,
+		ProductSalePrice:    product.SalePrice,
+		ProductRegularPrice: product.RegularPrice,
+		Weight:              product.Weight,
+		Quantity:            2,
+	}}}
+	if err := db.Create(&cart).Error; err != nil {
+		t.Fatalf("create cart: %v", err)
+	}
+	return product
+}
+
+func newRouter(db *gorm.DB, provider payment.PaymentProvider) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	signedIn := func(c *gin.Context) {
+		c.Set("user_id", testUserID)
+		c.Next()
+	}
+	r.POST("/payment/request", signedIn, PaymentRequestHandler(db, provider))
+	r.POST("/payment/webhook", TelrWebhookHandler(db, provider))
+	r.POST("/orders/:orderID/refunds", signedIn, RefundOrderHandler(db, provider))
+	return r
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// checkout opens a payment for the test user's cart and returns its session
+func checkout(t *testing.T, db *gorm.DB, r *gin.Engine) models.PaymentSession {
+	t.Helper()
+	w := serve(r, httptest.NewRequest(http.MethodPost, "/payment/request", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("payment request: %d %s", w.Code, w.Body.String())
+	}
+	var session models.PaymentSession
+	if err := db.Preload("Items").Where("user_id = ?", testUserID).Order("id DESC").First(&session).Error; err != nil {
+		t.Fatalf("load session: %v", err)
+	}
+	return session
+}
+
+func webhook(r *gin.Engine, session models.PaymentSession, tranRef string, status payment.Status, amount string) *httptest.ResponseRecorder {
+	form := url.Values{
+		"tran_cartid":   {session.Reference},
+		"tran_ref":      {tranRef},
+		"status":        {string(status)},
+		"tran_amount":   {amount},
+		"tran_currency": {session.Currency},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/payment/webhook", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return serve(r, req)
+}
+
+func TestPaymentRequestCreatesSessionAtServerPrice(t *testing.T) {
+	db := testdb.Open(t)
+	product := seedCart(t, db)
+	provider := &fakeProvider{}
+	r := newRouter(db, provider)
+
+	session := checkout(t, db, r)
+
+	// 2 x 50.00 plus the default 30.00 shipping for 2kg
+	if session.Subtotal != 100 || session.ShippingCost != 30 || session.Amount != 130 {
+		t.Errorf("session priced %.2f + %.2f = %.2f, want 100 + 30 = 130", session.Subtotal, session.ShippingCost, session.Amount)
+	}
+	if session.Status != models.PaymentSessionPending || session.TelrRef != "ref-"+session.Reference {
+		t.Errorf("session status %q ref %q", session.Status, session.TelrRef)
+	}
+	if len(provider.created) != 1 || provider.created[0].Amount != 130 || provider.created[0].Reference != session.Reference {
+		t.Errorf("provider got %+v", provider.created)
+	}
+	if len(session.Items) != 1 || session.Items[0].UnitPrice != 50 || session.Items[0].Quantity != 2 {
+		t.Errorf("session items %+v", session.Items)
+	}
+
+	var reserved int64
+	db.Model(&models.StockReservation{}).
+		Where("payment_session_id = ? AND product_id = ? AND status = ?", session.ID, product.ID, models.StockReservationActive).
+		Select("COALESCE(SUM(quantity), 0)").Scan(&reserved)
+	if reserved != 2 {
+		t.Errorf("reserved %d units, want 2", reserved)
+	}
+}
+
+func TestPaymentRequestAcceptsEmptyBody(t *testing.T) {
+	db := testdb.Open(t)
+	seedCart(t, db)
+	r := newRouter(db, &fakeProvider{})
+
+	req := httptest.NewRequest(http.MethodPost, "/payment/request", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/json")
+	if w := serve(r, req); w.Code != http.StatusOK {
+		t.Fatalf("payment request: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWebhookPlacesOrderFromCheckoutPrices(t *testing.T) {
+	db := testdb.Open(t)
+	product := seedCart(t, db)
+	r := newRouter(db, &fakeProvider{})
+	session := checkout(t, db, r)
+
+	// Price changes after checkout don't change what was paid for
+	db.Model(&product).Update("sale_price", 500)
+
+	if w := webhook(r, session, "T200", payment.StatusApproved, "130.00"); w.Code != http.StatusOK {
+		t.Fatalf("webhook: %d %s", w.Code, w.Body.String())
+	}
+	var order models.Order
+	if err := db.Preload("Items").Where("user_id = ?", testUserID).First(&order).Error; err != nil {
+		t.Fatalf("load order: %v", err)
+	}
+	if order.TotalAmount != 130 || len(order.Items) != 1 || order.Items[0].ProductSalePrice != 50 {
+		t.Errorf("order total %.2f items %+v, want 130 at 50.00 each", order.TotalAmount, order.Items)
+	}
+}
+
+func TestWebhookRejectsAmountMismatch(t *testing.T) {
+	db := testdb.Open(t)
+	seedCart(t, db)
+	r := newRouter(db, &fakeProvider{})
+	session := checkout(t, db, r)
+
+	w := webhook(r, session, "T300", payment.StatusApproved, "1.00")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("webhook: %d %s, want 400", w.Code, w.Body.String())
+	}
+
+	var orders, reservations int64
+	db.Model(&models.Order{}).Where("user_id = ?", testUserID).Count(&orders)
+	db.Model(&models.StockReservation{}).
+		Where("payment_session_id = ? AND status = ?", session.ID, models.StockReservationActive).Count(&reservations)
+	if orders != 0 || reservations != 0 {
+		t.Errorf("got %d orders and %d active reservations, want none", orders, reservations)
+	}
+	db.First(&session, session.ID)
+	if session.Status != models.PaymentSessionFailed || !strings.Contains(session.StatusMessage, "amount mismatch") {
+		t.Errorf("session status %q message %q", session.Status, session.StatusMessage)
+	}
+}
+
+func TestWebhookPlacesOrderOnce(t *testing.T) {
+	db := testdb.Open(t)
+	product := seedCart(t, db)
+	r := newRouter(db, &fakeProvider{})
+	session := checkout(t, db, r)
+
+	first := webhook(r, session, "T100", payment.StatusApproved, "130.00")
+	if first.Code != http.StatusOK {
+		t.Fatalf("first delivery: %d %s", first.Code, first.Body.String())
+	}
+	retry := webhook(r, session, "T100", payment.StatusApproved, "130.00")
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry answered %d %s, want the stored %d %s", retry.Code, retry.Body.String(), first.Code, first.Body.String())
+	}
+
+	var orders, events int64
+	db.Model(&models.Order{}).Where("user_id = ?", testUserID).Count(&orders)
+	db.Model(&models.PaymentWebhookEvent{}).Where("tran_ref = ?", "T100").Count(&events)
+	if orders != 1 || events != 1 {
+		t.Errorf("got %d orders and %d webhook events, want 1 of each", orders, events)
+	}
+
+	db.First(&session, session.ID)
+	if session.Status != models.PaymentSessionPaid || session.OrderID == nil {
+		t.Errorf("session status %q order %v, want paid with an order", session.Status, session.OrderID)
+	}
+	db.First(&product, product.ID)
+	if product.Stock != 8 {
+		t.Errorf("stock %d, want 8", product.Stock)
+	}
+}
+
+func TestPaymentRequestRejectsSecondPayment(t *testing.T) {
+	db := testdb.Open(t)
+	seedCart(t, db)
+	provider := &fakeProvider{}
+	r := newRouter(db, provider)
+	checkout(t, db, r)
+
+	w := serve(r, httptest.NewRequest(http.MethodPost, "/payment/request", nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("second payment request: %d %s, want 409", w.Code, w.Body.String())
+	}
+	var sessions int64
+	db.Model(&models.PaymentSession{}).Where("user_id = ?", testUserID).Count(&sessions)
+	if sessions != 1 || len(provider.created) != 1 {
+		t.Errorf("got %d sessions and %d gateway payments, want 1 of each", sessions, len(provider.created))
+	}
+}
+
+func TestWebhookRetriesAfterServerError(t *testing.T) {
+	db := testdb.Open(t)
+	product := seedCart(t, db)
+	r := newRouter(db, &fakeProvider{})
+	session := checkout(t, db, r)
+
+	// The order can't be placed while the stock is gone
+	db.Model(&product).Update("stock", 0)
+	if w := webhook(r, session, "T150", payment.StatusApproved, "130.00"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("first delivery: %d %s, want 500", w.Code, w.Body.String())
+	}
+	var events int64
+	db.Model(&models.PaymentWebhookEvent{}).Where("tran_ref = ?", "T150").Count(&events)
+	db.First(&session, session.ID)
+	if events != 0 || session.Status != models.PaymentSessionPending {
+		t.Errorf("got %d stored events and session %q, want none and still pending", events, session.Status)
+	}
+
+	// The gateway's retry is processed again
+	db.Model(&product).Update("stock", 10)
+	if w := webhook(r, session, "T150", payment.StatusApproved, "130.00"); w.Code != http.StatusOK {
+		t.Fatalf("retry: %d %s, want 200", w.Code, w.Body.String())
+	}
+	db.First(&session, session.ID)
+	if session.Status != models.PaymentSessionPaid || session.OrderID == nil {
+		t.Errorf("session status %q order %v, want paid with an order", session.Status, session.OrderID)
+	}
+}
+
+func TestWebhookCancelReleasesStock(t *testing.T) {
+	db := testdb.Open(t)
+	seedCart(t, db)
+	r := newRouter(db, &fakeProvider{})
+	session := checkout(t, db, r)
+
+	if w := webhook(r, session, "T350", payment.StatusCancelled, "130.00"); w.Code != http.StatusOK {
+		t.Fatalf("webhook: %d %s", w.Code, w.Body.String())
+	}
+	var active int64
+	db.Model(&models.StockReservation{}).
+		Where("payment_session_id = ? AND status = ?", session.ID, models.StockReservationActive).Count(&active)
+	db.First(&session, session.ID)
+	if active != 0 || session.Status != models.PaymentSessionCancelled {
+		t.Errorf("got %d active reservations and session %q, want none and cancelled", active, session.Status)
+	}
+}
@@ -0,0 +1,57 @@
+// Package testdb opens the Postgres database that DB-backed tests run against.
+// See the README for setting up TEST_DATABASE_URL.
+package testdb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open migrates the database in TEST_DATABASE_URL and returns a transaction
+// rolled back when the test ends. The test is skipped without a database.
+func Open(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Product{},
+		&models.Category{},
+		&models.GuestCart{},
+		&models.GuestCartItem{},
+		&models.Cart{},
+		&models.CartItem{},
+		&models.Order{},
+		&models.OrderItem{},
+		&models.OrderStatusHistory{},
+		&models.PaymentSession{},
+		&models.PaymentSessionItem{},
+		&models.PaymentWebhookEvent{},
+		&models.Refund{},
+		&models.RefundItem{},
+		&models.StockReservation{},
+		&models.StockMovement{},
+		&models.ShippingRule{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.PriceSchedule{},
+	); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
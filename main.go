@@ -11,7 +11,11 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	orderControllers "github.com/junaidrashid-git/ecommerce-api/controllers/order"
+	productcontroller "github.com/junaidrashid-git/ecommerce-api/controllers/product"
+	telrControllers "github.com/junaidrashid-git/ecommerce-api/controllers/telr"
 	"github.com/junaidrashid-git/ecommerce-api/models"
+	"github.com/junaidrashid-git/ecommerce-api/payment"
 	"github.com/junaidrashid-git/ecommerce-api/routes"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -39,13 +43,38 @@ func main() {
 		&models.CartItem{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderStatusHistory{},
 		&models.Banner{},
 		&models.QRFile{},
+		&models.PaymentSession{},
+		&models.PaymentWebhookEvent{},
+		&models.Refund{},
+		&models.RefundItem{},
+		&models.AdminAction{},
+		&models.StockReservation{},
+		&models.StockMovement{},
+		&models.ShippingRule{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.PriceSchedule{},
+		&models.PaymentSessionItem{},
 	); err != nil {
 		log.Fatalf("❌ AutoMigrate failed: %v", err)
 	}
 
+	// Full-text search indexes, falls back to ILIKE when unavailable
+	productcontroller.EnsureProductSearch(db)
+
+	// Payment gateway
+	telrConfig := payment.TelrConfigFromEnv()
+	if telrConfig.WebhookSecret == "" && !telrConfig.TestMode {
+		log.Fatal("❌ TELR_WEBHOOK_SECRET is not set")
+	}
+	provider := payment.NewTelrProvider(telrConfig, nil)
+
 	StartGuestCleanup(db)
+	StartPaymentReconciler(db, provider)
+	StartReservationSweeper(db)
 
 	// Gin setup
 	r := gin.Default()
@@ -58,7 +87,7 @@ func main() {
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-KEY"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Link", "X-Total-Count"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -71,7 +100,7 @@ func main() {
 	r.Static("/uploads", uploadsDir)
 
 	// Setup routes
-	routes.SetupRoutes(r, db)
+	routes.SetupRoutes(r, db, provider)
 
 	// Start backup routine at 2 AM daily, keep 4 days of backups
 	go startDailyBackupAtFixedTime(uploadsDir, backupDir, 4*24*time.Hour, 2, 0)
@@ -223,3 +252,42 @@ func StartGuestCleanup(db *gorm.DB) {
 		}
 	}()
 }
+
+// StartPaymentReconciler periodically asks the payment provider about sessions whose
+// webhook never arrived and places or fails their orders.
+func StartPaymentReconciler(db *gorm.DB, provider payment.PaymentProvider) {
+	ticker := time.NewTicker(10 * time.Minute)
+	go func() {
+		for range ticker.C {
+			resolved, failed, err := telrControllers.ReconcilePendingPayments(db, provider, 30*time.Minute)
+			if err != nil {
+				log.Printf("❌ Payment reconciliation failed: %v", err)
+				continue
+			}
+			if resolved > 0 {
+				log.Printf("✅ Reconciled %d pending payment session(s)", resolved)
+			}
+			if failed > 0 {
+				log.Printf("⚠️ %d paid payment session(s) could not be settled and need review", failed)
+			}
+		}
+	}()
+}
+
+// StartReservationSweeper releases checkout stock reservations once their TTL has passed
+// and their payment is no longer pending at the gateway.
+func StartReservationSweeper(db *gorm.DB) {
+	ticker := time.NewTicker(5 * time.Minute)
+	go func() {
+		for range ticker.C {
+			released, err := orderControllers.ReleaseExpiredReservations(db)
+			if err != nil {
+				log.Printf("❌ Releasing expired stock reservations failed: %v", err)
+				continue
+			}
+			if released > 0 {
+				log.Printf("✅ Released %d expired stock reservation(s)", released)
+			}
+		}
+	}()
+}
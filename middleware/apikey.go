@@ -1,19 +1,28 @@
 package middleware
 
 import (
-	"github.com/gin-gonic/gin"
-	"net/http"
+	"crypto/subtle"
 	"os"
-)
 
+	"github.com/gin-gonic/gin"
+)
 
+// apiKeyAdmin marks requests admitted by the legacy API key
+const apiKeyAdmin = "api_key_admin"
 
+// ValidateAPIKey keeps the old shared X-API-KEY working on admin routes while
+// clients move to admin JWTs. It is off unless ALLOW_LEGACY_API_KEY is "true":
+// a matching COST_API_KEY then passes as a regular admin, audited as "api-key",
+// and any other request falls through to the JWT checks after it.
+// Superadmin-only routes always need a JWT.
 func ValidateAPIKey(c *gin.Context) {
-	apiKey := c.GetHeader("X-API-KEY")
-	if apiKey != os.Getenv("COST_API_KEY") {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing API key"})
-		c.Abort()
-		return
+	expected := os.Getenv("COST_API_KEY")
+	provided := c.GetHeader("X-API-KEY")
+	if os.Getenv("ALLOW_LEGACY_API_KEY") == "true" && expected != "" && provided != "" &&
+		subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1 {
+		c.Set(apiKeyAdmin, true)
+		c.Set("role", RoleAdmin)
+		c.Set("email", "api-key")
 	}
 	c.Next()
 }
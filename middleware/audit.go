@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// AuditAdminActions records every non-GET request with the admin who made it.
+// Must run after ValidateToken.
+func AuditAdminActions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodOptions {
+			return
+		}
+
+		action := models.AdminAction{
+			Actor:      Actor(c),
+			Role:       c.GetString("role"),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			StatusCode: c.Writer.Status(),
+		}
+		if err := db.Create(&action).Error; err != nil {
+			log.Printf("❌ Failed to record admin action %s %s by %s: %v", action.Method, action.Path, action.Actor, err)
+		}
+	}
+}
@@ -10,6 +10,12 @@ import (
 )
 
 func ValidateToken(c *gin.Context) {
+	// Already admitted by the legacy API key
+	if c.GetBool(apiKeyAdmin) {
+		c.Next()
+		return
+	}
+
 	// Get the token from the header
 	tokenString := c.GetHeader("Authorization")
 	if tokenString == "" {
@@ -44,6 +50,19 @@ func ValidateToken(c *gin.Context) {
 
 	// Optionally set the user info in the context for further use (e.g., user ID)
 	c.Set("user_id", claims["user_id"])
+	c.Set("role", claims["role"])
+	c.Set("email", claims["email"])
+
+	c.Next()
+}
 
+// TokenFromQuery lets clients that cannot set headers, such as browser WebSockets,
+// send the JWT as the token query parameter. Must run before ValidateToken.
+func TokenFromQuery(c *gin.Context) {
+	if c.GetHeader("Authorization") == "" {
+		if token := c.Query("token"); token != "" {
+			c.Request.Header.Set("Authorization", token)
+		}
+	}
 	c.Next()
 }
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// Roles issued in JWTs by the auth package
+const (
+	RoleSuperAdmin = "superadmin"
+	RoleAdmin      = "admin"
+	RoleUser       = "user"
+	RoleGuest      = "guest"
+)
+
+// RequireRole allows the request only if the token's role is one of roles.
+// Must run after ValidateToken.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		allowed[role] = true
+	}
+
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if !allowed[role] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireActiveAdmin checks admin tokens against the admin table, since they stay
+// valid for months: the admin must still exist and be approved, and superadmin
+// tokens must belong to SUPER_ADMIN_EMAIL. Must run after RequireRole.
+func RequireActiveAdmin(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(apiKeyAdmin) {
+			c.Next()
+			return
+		}
+
+		email := c.GetString("email")
+		switch c.GetString("role") {
+		case RoleSuperAdmin:
+			if email == "" || email != os.Getenv("SUPER_ADMIN_EMAIL") {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Admin access has been revoked"})
+				c.Abort()
+				return
+			}
+		case RoleAdmin:
+			var admin models.Admin
+			err := db.Select("id", "approved").Where("email = ?", email).First(&admin).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !admin.Approved) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Admin access has been revoked"})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check admin access"})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// Actor identifies who is making the request, for audit fields.
+// Admins are identified by email, everyone else by user ID.
+func Actor(c *gin.Context) string {
+	if email := c.GetString("email"); email != "" {
+		return email
+	}
+	if userID := c.GetString("user_id"); userID != "" {
+		return userID
+	}
+	return "unknown"
+}
@@ -1,9 +1,10 @@
 package models
 
 type Admin struct {
-	ID       uint   `gorm:"primaryKey"`
-	Email    string `gorm:"unique"`
-	Name     string
-	Picture  string
-	Approved bool
+	ID         uint   `gorm:"primaryKey"`
+	Email      string `gorm:"unique"`
+	Name       string
+	Picture    string
+	Approved   bool
+	ApprovedBy string // superadmin who approved the account
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// AdminAction is an audit record of a state-changing request made by an admin.
+type AdminAction struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Actor      string    `gorm:"index;not null" json:"actor"` // admin email from the JWT
+	Role       string    `gorm:"type:VARCHAR(20)" json:"role"`
+	Method     string    `gorm:"type:VARCHAR(10)" json:"method"`
+	Path       string    `json:"path"`
+	StatusCode int       `json:"status_code"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
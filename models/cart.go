@@ -3,11 +3,12 @@ package models
 import "time"
 
 type Cart struct {
-	CartID    uint       `gorm:"primaryKey"`
-	UserID    string     `gorm:"uniqueIndex"`                                   // Enforces ONE cart per user
-	Items     []CartItem `gorm:"foreignKey:CartID;constraint:OnDelete:CASCADE"` // Cascade delete items if cart is deleted
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	CartID     uint       `gorm:"primaryKey"`
+	UserID     string     `gorm:"uniqueIndex"`                                   // Enforces ONE cart per user
+	Items      []CartItem `gorm:"foreignKey:CartID;constraint:OnDelete:CASCADE"` // Cascade delete items if cart is deleted
+	CouponCode string     // Coupon applied to the cart, checked again at checkout
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
 }
 
 type CartItem struct {
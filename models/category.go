@@ -1,9 +1,203 @@
 package models
 
+import (
+	"errors"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCategoryParentNotFound = errors.New("parent category not found")
+	ErrCategoryCycle          = errors.New("a category cannot be moved under itself or its descendants")
+)
+
 type Category struct {
-	ID       uint   `gorm:"primaryKey;autoIncrement"`
-	EName    string `gorm:"unique;not null"`
-	ARName   string `gorm:"unique;not null"`
-	Image    string
-	Products []Product `gorm:"many2many:product_categories"`
+	ID     uint   `gorm:"primaryKey;autoIncrement"`
+	EName  string `gorm:"unique;not null"`
+	ARName string `gorm:"unique;not null"`
+	Image  string
+	// ParentID nests the category under another one; nil for top-level categories
+	ParentID *uint `gorm:"index"`
+	// SortOrder orders categories among their siblings, lowest first
+	SortOrder int        `gorm:"default:0;index"`
+	Children  []Category `gorm:"foreignKey:ParentID" json:",omitempty"`
+	Products  []Product  `gorm:"many2many:product_categories" json:",omitempty"`
+	// ProductCount and CoverImage are filled in by ApplyCategoryStats for listings; not stored
+	ProductCount int64  `gorm:"-" json:",omitempty"`
+	CoverImage   string `gorm:"-" json:",omitempty"`
+}
+
+// CategoryDescendantsSQL selects the categories whose IDs are bound to its
+// placeholder and everything nested under them. Use it as a subquery, e.g.
+// "category_id IN (" + CategoryDescendantsSQL + ")".
+const CategoryDescendantsSQL = `
+	WITH RECURSIVE tree AS (
+		SELECT id FROM categories WHERE id IN ?
+		UNION
+		SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+	)
+	SELECT id FROM tree`
+
+// ProductCategoryAncestorsSQL selects the categories of the outer query's products
+// row and every category above them. Use it in a correlated subquery, e.g.
+// "category_id IN (" + ProductCategoryAncestorsSQL + ")", so rules set on a
+// category reach products in its subcategories.
+const ProductCategoryAncestorsSQL = `
+	WITH RECURSIVE up AS (
+		SELECT category_id AS id FROM product_categories WHERE product_id = products.id
+		UNION
+		SELECT c.parent_id FROM categories c JOIN up u ON c.id = u.id WHERE c.parent_id IS NOT NULL
+	)
+	SELECT id FROM up`
+
+// CategoryDescendantIDs returns the IDs of the given categories and all their descendants
+func CategoryDescendantIDs(db *gorm.DB, ids []uint) ([]uint, error) {
+	var result []uint
+	err := db.Raw(CategoryDescendantsSQL, ids).Scan(&result).Error
+	return result, err
+}
+
+// ValidateCategoryParent checks that category id can be placed under parentID:
+// the parent must exist and must not be the category itself or one of its descendants.
+// Pass id 0 for a category that does not exist yet.
+func ValidateCategoryParent(db *gorm.DB, id uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&Category{}).Where("id = ?", *parentID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrCategoryParentNotFound
+	}
+	if id == 0 {
+		return nil
+	}
+
+	subtree, err := CategoryDescendantIDs(db, []uint{id})
+	if err != nil {
+		return err
+	}
+	for _, cid := range subtree {
+		if cid == *parentID {
+			return ErrCategoryCycle
+		}
+	}
+	return nil
+}
+
+// SortCategories orders categories by SortOrder, then English name
+func SortCategories(categories []Category) {
+	sort.SliceStable(categories, func(i, j int) bool {
+		if categories[i].SortOrder != categories[j].SortOrder {
+			return categories[i].SortOrder < categories[j].SortOrder
+		}
+		return categories[i].EName < categories[j].EName
+	})
+}
+
+// BuildCategoryTree nests a flat list of categories under their parents and
+// returns the top-level ones, each level sorted. Categories whose parent is not
+// in the list are treated as top-level.
+func BuildCategoryTree(categories []Category) []Category {
+	present := make(map[uint]bool, len(categories))
+	for _, cat := range categories {
+		present[cat.ID] = true
+	}
+
+	children := make(map[uint][]Category)
+	var roots []Category
+	for _, cat := range categories {
+		cat.Children = nil
+		if cat.ParentID != nil && present[*cat.ParentID] {
+			children[*cat.ParentID] = append(children[*cat.ParentID], cat)
+		} else {
+			roots = append(roots, cat)
+		}
+	}
+
+	var attach func(level []Category) []Category
+	attach = func(level []Category) []Category {
+		if level == nil {
+			return []Category{}
+		}
+		SortCategories(level)
+		for i := range level {
+			level[i].Children = attach(children[level[i].ID])
+		}
+		return level
+	}
+	return attach(roots)
+}
+
+// categoryLineageSQL pairs every category with itself and each of its
+// descendants, so product rows can be rolled up to all their ancestors
+const categoryLineageSQL = `
+	WITH RECURSIVE lineage AS (
+		SELECT id AS ancestor_id, id AS category_id FROM categories WHERE id IN ?
+		UNION
+		SELECT l.ancestor_id, c.id FROM categories c JOIN lineage l ON c.parent_id = l.category_id
+	)`
+
+// ApplyCategoryStats sets ProductCount and CoverImage on categories for display.
+// Counts include products in subcategories, each product counted once, and skip
+// deleted products. CoverImage is the category's own image, or else the image of
+// its newest product.
+func ApplyCategoryStats(db *gorm.DB, categories []Category) error {
+	if len(categories) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(categories))
+	for i, cat := range categories {
+		ids[i] = cat.ID
+	}
+
+	var counts []struct {
+		AncestorID uint
+		Count      int64
+	}
+	if err := db.Raw(categoryLineageSQL+`
+		SELECT l.ancestor_id, COUNT(DISTINCT p.id) AS count
+		FROM lineage l
+		JOIN product_categories pc ON pc.category_id = l.category_id
+		JOIN products p ON p.id = pc.product_id AND p.deleted_at IS NULL
+		GROUP BY l.ancestor_id`, ids).Scan(&counts).Error; err != nil {
+		return err
+	}
+
+	var covers []struct {
+		AncestorID uint
+		Image      string
+	}
+	if err := db.Raw(categoryLineageSQL+`
+		SELECT DISTINCT ON (l.ancestor_id) l.ancestor_id, p.image
+		FROM lineage l
+		JOIN product_categories pc ON pc.category_id = l.category_id
+		JOIN products p ON p.id = pc.product_id AND p.deleted_at IS NULL
+		WHERE p.image <> ''
+		ORDER BY l.ancestor_id, p.created_at DESC, p.id DESC`, ids).Scan(&covers).Error; err != nil {
+		return err
+	}
+
+	countByID := make(map[uint]int64, len(counts))
+	for _, row := range counts {
+		countByID[row.AncestorID] = row.Count
+	}
+	coverByID := make(map[uint]string, len(covers))
+	for _, row := range covers {
+		coverByID[row.AncestorID] = row.Image
+	}
+
+	for i := range categories {
+		cat := &categories[i]
+		cat.ProductCount = countByID[cat.ID]
+		cat.CoverImage = cat.Image
+		if cat.CoverImage == "" {
+			cat.CoverImage = coverByID[cat.ID]
+		}
+	}
+	return nil
 }
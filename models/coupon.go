@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+type CouponType string
+
+const (
+	CouponPercent      CouponType = "percent"       // Value is a percentage of the eligible subtotal
+	CouponFixed        CouponType = "fixed"         // Value is an amount off the eligible subtotal
+	CouponFreeShipping CouponType = "free_shipping" // Waives the shipping cost
+)
+
+// Coupon is a discount code customers apply to their cart.
+// When Categories or Products are set, only matching cart lines are discounted;
+// a category also matches products in its subcategories.
+type Coupon struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Code         string     `gorm:"uniqueIndex;not null" json:"code"` // stored upper-case
+	Description  string     `json:"description"`
+	Type         CouponType `gorm:"type:VARCHAR(20);not null" json:"type"`
+	Value        float64    `json:"value"`
+	MaxDiscount  float64    `json:"max_discount"`   // caps percentage discounts; 0 = no cap
+	MinCartValue float64    `json:"min_cart_value"` // cart subtotal needed to use the coupon
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	UsageLimit   int        `json:"usage_limit"`    // total redemptions allowed; 0 = unlimited
+	PerUserLimit int        `json:"per_user_limit"` // redemptions allowed per user; 0 = unlimited
+	Active       bool       `gorm:"default:true" json:"active"`
+	Categories   []Category `gorm:"many2many:coupon_categories" json:"categories"`
+	Products     []Product  `gorm:"many2many:coupon_products" json:"products"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// CouponRedemption records a coupon used on an order and counts towards its usage limits
+type CouponRedemption struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CouponID  uint      `gorm:"index;not null" json:"coupon_id"`
+	UserID    string    `gorm:"index;not null" json:"user_id"`
+	OrderID   uint      `gorm:"index;not null" json:"order_id"`
+	Discount  float64   `json:"discount"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -20,19 +20,60 @@ const (
 	PaymentStatusPaid     PaymentStatus = "paid"     // Payment completed successfully
 	PaymentStatusFailed   PaymentStatus = "failed"   // Payment attempt failed
 	PaymentStatusRefunded PaymentStatus = "refunded" // Money returned to customer
+
+	PaymentStatusPartiallyRefunded PaymentStatus = "partially_refunded" // Part of the money returned
+
+	// Payment methods
+	PaymentMethodCard = "card" // Paid online through the payment gateway
+	PaymentMethodCOD  = "cod"  // Cash collected on delivery
 )
 
+// orderTransitions lists the statuses an order may move to from each status
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:     {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed:   {OrderStatusReadyToShip, OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusReadyToShip: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:     {OrderStatusDelivered, OrderStatusReturned},
+	OrderStatusDelivered:   {OrderStatusReturned},
+	OrderStatusReturned:    {},
+	OrderStatusCancelled:   {},
+}
+
+// CanTransitionTo reports whether an order in status s may move to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 type Order struct {
-	ID            uint          `gorm:"primaryKey" json:"id"`
-	UserID        string        `gorm:"not null" json:"user_id"`
-	User          User          `gorm:"foreignKey:UserID" json:"user"`
-	Items         []OrderItem   `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"items"`
-	ShippingCost  float64       `json:"shipping_cost"`
-	TotalAmount   float64       `json:"total_amount"`
-	Status        OrderStatus   `gorm:"type:VARCHAR(20);default:'pending'" json:"status"`
-	PaymentStatus PaymentStatus `gorm:"type:VARCHAR(20);default:'pending'" json:"payment_status"`
-	PaymentMethod string        `json:"payment_method"` // e.g. "card", "cod"
-	CreatedAt     time.Time     `json:"created_at"`
+	ID            uint                 `gorm:"primaryKey" json:"id"`
+	UserID        string               `gorm:"not null" json:"user_id"`
+	User          User                 `gorm:"foreignKey:UserID" json:"user"`
+	Items         []OrderItem          `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"items"`
+	ShippingCost  float64              `json:"shipping_cost"`
+	CouponCode    string               `json:"coupon_code"`
+	Discount      float64              `json:"discount"` // coupon discount taken off the total
+	TotalAmount   float64              `json:"total_amount"`
+	Status        OrderStatus          `gorm:"type:VARCHAR(20);default:'pending'" json:"status"`
+	PaymentStatus PaymentStatus        `gorm:"type:VARCHAR(20);default:'pending'" json:"payment_status"`
+	PaymentMethod string               `json:"payment_method"` // e.g. "card", "cod"
+	StatusHistory []OrderStatusHistory `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"status_history"`
+	CreatedAt     time.Time            `json:"created_at"`
+}
+
+// OrderStatusHistory records every status change of an order
+type OrderStatusHistory struct {
+	ID         uint        `gorm:"primaryKey" json:"id"`
+	OrderID    uint        `gorm:"index;not null" json:"order_id"`
+	FromStatus OrderStatus `gorm:"type:VARCHAR(20)" json:"from_status"` // empty when the order was created
+	ToStatus   OrderStatus `gorm:"type:VARCHAR(20)" json:"to_status"`
+	Actor      string      `json:"actor"`
+	Note       string      `json:"note"`
+	CreatedAt  time.Time   `json:"created_at"`
 }
 
 type OrderItem struct {
@@ -46,4 +87,5 @@ type OrderItem struct {
 	ProductRegularPrice float64
 	Weight              float64
 	Quantity            int
+	RestockedQuantity   int // units put back into stock after a cancellation or return
 }
@@ -0,0 +1,44 @@
+package models
+
+import "testing"
+
+func TestOrderStatusCanTransitionTo(t *testing.T) {
+	all := []OrderStatus{
+		OrderStatusPending,
+		OrderStatusConfirmed,
+		OrderStatusReadyToShip,
+		OrderStatusShipped,
+		OrderStatusDelivered,
+		OrderStatusReturned,
+		OrderStatusCancelled,
+	}
+	allowed := map[OrderStatus][]OrderStatus{
+		OrderStatusPending:     {OrderStatusConfirmed, OrderStatusCancelled},
+		OrderStatusConfirmed:   {OrderStatusReadyToShip, OrderStatusShipped, OrderStatusCancelled},
+		OrderStatusReadyToShip: {OrderStatusShipped, OrderStatusCancelled},
+		OrderStatusShipped:     {OrderStatusDelivered, OrderStatusReturned},
+		OrderStatusDelivered:   {OrderStatusReturned},
+		OrderStatusReturned:    nil,
+		OrderStatusCancelled:   nil,
+	}
+
+	// Every pair of statuses, including staying put, is either allowed or rejected
+	for _, from := range all {
+		for _, to := range all {
+			want := false
+			for _, next := range allowed[from] {
+				if next == to {
+					want = true
+				}
+			}
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s: got %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	// Unknown statuses go nowhere and can't be reached
+	if OrderStatus("lost").CanTransitionTo(OrderStatusPending) || OrderStatusPending.CanTransitionTo("lost") {
+		t.Error("unknown status allowed in a transition")
+	}
+}
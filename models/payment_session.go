@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+type PaymentSessionStatus string
+
+const (
+	PaymentSessionPending   PaymentSessionStatus = "pending"   // Telr session opened, awaiting webhook
+	PaymentSessionPaid      PaymentSessionStatus = "paid"      // Payment authorised and order placed
+	PaymentSessionFailed    PaymentSessionStatus = "failed"    // Declined, errored or rejected by us
+	PaymentSessionCancelled PaymentSessionStatus = "cancelled" // Customer cancelled on the payment page
+	PaymentSessionError     PaymentSessionStatus = "error"     // Payment authorised but the order could not be placed
+)
+
+// PaymentSession tracks one payment attempt from checkout through the Telr webhook.
+// Amounts are computed on the server at checkout and the webhook is verified against them.
+// The priced lines are stored with the session and the order is placed from them,
+// so cart or price changes after checkout can't change what was paid for.
+type PaymentSession struct {
+	ID            uint                 `gorm:"primaryKey" json:"id"`
+	Reference     string               `gorm:"uniqueIndex" json:"reference"` // sent to Telr as cartid
+	CartID        uint                 `gorm:"index;not null" json:"cart_id"`
+	UserID        string               `gorm:"index;not null" json:"user_id"`
+	Provider      string               `gorm:"type:VARCHAR(20);default:'telr';index" json:"provider"`
+	TelrRef       string               `gorm:"index" json:"telr_ref"` // payment ref returned by the provider on create
+	TranRef       string               `gorm:"index" json:"tran_ref"` // transaction ref from the webhook
+	Subtotal      float64              `json:"subtotal"`
+	ShippingCost  float64              `json:"shipping_cost"`
+	CouponCode    string               `json:"coupon_code"`
+	Discount      float64              `json:"discount"`
+	Amount        float64              `json:"amount"`
+	Currency      string               `gorm:"type:VARCHAR(3)" json:"currency"`
+	Status        PaymentSessionStatus `gorm:"type:VARCHAR(20);default:'pending';index" json:"status"`
+	StatusMessage string               `json:"status_message"`
+	OrderID       *uint                `gorm:"index" json:"order_id"`
+	Order         *Order               `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	Items         []PaymentSessionItem `gorm:"foreignKey:PaymentSessionID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+	CompletedAt   *time.Time           `json:"completed_at"`
+}
+
+// PaymentSessionItem is a cart line as priced at checkout
+type PaymentSessionItem struct {
+	ID               uint    `gorm:"primaryKey" json:"id"`
+	PaymentSessionID uint    `gorm:"index;not null" json:"payment_session_id"`
+	ProductID        uint    `gorm:"not null" json:"product_id"`
+	ProductEName     string  `json:"product_ename"`
+	ProductArName    string  `json:"product_arname"`
+	ProductImage     string  `json:"product_image"`
+	UnitPrice        float64 `json:"unit_price"`
+	RegularPrice     float64 `json:"regular_price"`
+	Weight           float64 `json:"weight"` // per unit
+	Quantity         int     `json:"quantity"`
+}
+
+// PaymentWebhookEvent records the first outcome of a webhook delivery, keyed by the
+// gateway transaction ref, so retried deliveries are answered without reprocessing.
+type PaymentWebhookEvent struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	TranRef      string    `gorm:"uniqueIndex;not null" json:"tran_ref"`
+	Reference    string    `gorm:"index" json:"reference"`
+	TranStatus   string    `gorm:"type:VARCHAR(20)" json:"tran_status"`
+	ResponseCode int       `json:"response_code"`
+	ResponseBody string    `gorm:"type:text" json:"response_body"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -19,7 +19,19 @@ type Product struct {
 	Weight        float64    `gorm:"not null"` // Required
 	Categories    []Category `gorm:"many2many:product_categories;"`
 	Stock         int
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	DeletedAt     gorm.DeletedAt `gorm:"index"`
+	// ReorderThreshold flags the product as low on stock once Stock falls to it; 0 disables alerts
+	ReorderThreshold int `gorm:"default:0"`
+	// EffectivePrice is what the product sells for right now, SalePrice or a running
+	// schedule's price. Only public listings fill it in; never stored.
+	EffectivePrice *float64 `gorm:"->;-:migration" json:",omitempty"`
+	// ActiveSchedule is the price schedule behind EffectivePrice when a sale is running; not stored
+	ActiveSchedule *PriceSchedule `gorm:"-" json:",omitempty"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+// LowStock reports whether the product is at or below its reorder threshold.
+func (p Product) LowStock() bool {
+	return p.ReorderThreshold > 0 && p.Stock <= p.ReorderThreshold
 }
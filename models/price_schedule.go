@@ -0,0 +1,181 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PriceSchedule puts a product, or every product in a category and its
+// subcategories, on sale between StartsAt and EndsAt. It sets either a fixed
+// SalePrice or PercentOff the product's normal sale price.
+type PriceSchedule struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Name       string    `json:"name"`
+	ProductID  *uint     `gorm:"index" json:"product_id"`
+	CategoryID *uint     `gorm:"index" json:"category_id"`
+	SalePrice  float64   `json:"sale_price"`
+	PercentOff float64   `json:"percent_off"`
+	StartsAt   time.Time `gorm:"index;not null" json:"starts_at"`
+	EndsAt     time.Time `gorm:"index;not null" json:"ends_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// PriceFor returns the scheduled price of a product whose normal sale price is base
+func (s PriceSchedule) PriceFor(base float64) float64 {
+	if s.SalePrice > 0 {
+		return s.SalePrice
+	}
+	return math.Round(base*(100-s.PercentOff)) / 100
+}
+
+// scheduledPriceSQL is PriceFor in SQL, for a schedule ps on the products row
+const scheduledPriceSQL = `CASE WHEN ps.sale_price > 0 THEN ps.sale_price
+	ELSE ROUND((products.sale_price * (100 - ps.percent_off))::numeric) / 100 END`
+
+// EffectivePriceSQL is EffectivePrice as an SQL expression on the products table,
+// for filtering and sorting listings by what products sell for right now
+const EffectivePriceSQL = `COALESCE(
+	(SELECT MIN(` + scheduledPriceSQL + `) FROM price_schedules ps
+		WHERE ps.starts_at <= CURRENT_TIMESTAMP AND ps.ends_at > CURRENT_TIMESTAMP
+		AND ps.product_id = products.id),
+	(SELECT MIN(` + scheduledPriceSQL + `) FROM price_schedules ps
+		WHERE ps.starts_at <= CURRENT_TIMESTAMP AND ps.ends_at > CURRENT_TIMESTAMP
+		AND ps.category_id IN (` + ProductCategoryAncestorsSQL + `)),
+	products.sale_price)`
+
+// activePriceSchedules loads schedules running now: the category-wide ones, and
+// those for the given products or for every product when productIDs is nil
+func activePriceSchedules(db *gorm.DB, productIDs []uint) ([]PriceSchedule, error) {
+	now := time.Now()
+	query := db.Where("starts_at <= ? AND ends_at > ?", now, now)
+	if productIDs != nil {
+		query = query.Where("product_id IN ? OR category_id IS NOT NULL", productIDs)
+	}
+
+	var schedules []PriceSchedule
+	err := query.Find(&schedules).Error
+	return schedules, err
+}
+
+// scheduledCategories maps every category to the categories above or at it that
+// schedules target, so a category-wide sale covers its subcategories too
+func scheduledCategories(db *gorm.DB, schedules []PriceSchedule) (map[uint][]uint, error) {
+	var targeted []uint
+	for _, s := range schedules {
+		if s.CategoryID != nil {
+			targeted = append(targeted, *s.CategoryID)
+		}
+	}
+	covering := make(map[uint][]uint)
+	if len(targeted) == 0 {
+		return covering, nil
+	}
+
+	var rows []struct {
+		AncestorID uint
+		CategoryID uint
+	}
+	if err := db.Raw(categoryLineageSQL+`
+		SELECT ancestor_id, category_id FROM lineage`, targeted).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		covering[row.CategoryID] = append(covering[row.CategoryID], row.AncestorID)
+	}
+	return covering, nil
+}
+
+// coveringCategories returns the scheduled categories containing any of a
+// product's categories, directly or through subcategories
+func coveringCategories(covering map[uint][]uint, categoryIDs []uint) []uint {
+	var result []uint
+	for _, id := range categoryIDs {
+		result = append(result, covering[id]...)
+	}
+	return result
+}
+
+// pickPriceSchedule returns the schedule giving the lowest price for a product.
+// Schedules for the product itself win over category-wide ones; categoryIDs are
+// the categories whose schedules cover the product.
+func pickPriceSchedule(schedules []PriceSchedule, product Product, categoryIDs []uint) *PriceSchedule {
+	inCategory := make(map[uint]bool, len(categoryIDs))
+	for _, id := range categoryIDs {
+		inCategory[id] = true
+	}
+
+	var best *PriceSchedule
+	bestForProduct := false
+	for i := range schedules {
+		s := &schedules[i]
+		forProduct := s.ProductID != nil && *s.ProductID == product.ID
+		if !forProduct && (s.CategoryID == nil || !inCategory[*s.CategoryID]) {
+			continue
+		}
+		switch {
+		case best == nil,
+			forProduct && !bestForProduct,
+			forProduct == bestForProduct && s.PriceFor(product.SalePrice) < best.PriceFor(product.SalePrice):
+			best, bestForProduct = s, forProduct
+		}
+	}
+	return best
+}
+
+// EffectivePrice returns what a product sells for right now, taking running
+// price schedules into account, and the schedule applied if any.
+func EffectivePrice(db *gorm.DB, product Product) (float64, *PriceSchedule, error) {
+	var categoryIDs []uint
+	if err := db.Table("product_categories").Where("product_id = ?", product.ID).
+		Pluck("category_id", &categoryIDs).Error; err != nil {
+		return 0, nil, err
+	}
+
+	schedules, err := activePriceSchedules(db, []uint{product.ID})
+	if err != nil {
+		return 0, nil, err
+	}
+	covering, err := scheduledCategories(db, schedules)
+	if err != nil {
+		return 0, nil, err
+	}
+	if s := pickPriceSchedule(schedules, product, coveringCategories(covering, categoryIDs)); s != nil {
+		return s.PriceFor(product.SalePrice), s, nil
+	}
+	return product.SalePrice, nil, nil
+}
+
+// ApplyPriceSchedules sets EffectivePrice and ActiveSchedule on products for display,
+// leaving SalePrice as stored. Categories must be preloaded.
+func ApplyPriceSchedules(db *gorm.DB, products []Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	schedules, err := activePriceSchedules(db, nil)
+	if err != nil {
+		return err
+	}
+	covering, err := scheduledCategories(db, schedules)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		p := &products[i]
+		categoryIDs := make([]uint, 0, len(p.Categories))
+		for _, cat := range p.Categories {
+			categoryIDs = append(categoryIDs, cat.ID)
+		}
+		price := p.SalePrice
+		if s := pickPriceSchedule(schedules, *p, coveringCategories(covering, categoryIDs)); s != nil {
+			price = s.PriceFor(p.SalePrice)
+			p.ActiveSchedule = s
+		}
+		p.EffectivePrice = &price
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "pending"   // Sent to the gateway, awaiting confirmation
+	RefundStatusCompleted RefundStatus = "completed" // Confirmed by the gateway
+	RefundStatusFailed    RefundStatus = "failed"    // Rejected by or failed to reach the gateway
+)
+
+// Refund is money returned to the customer for an order, in full or in part.
+type Refund struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	OrderID        uint         `gorm:"index;not null" json:"order_id"`
+	Items          []RefundItem `gorm:"foreignKey:RefundID;constraint:OnDelete:CASCADE" json:"items"`
+	Amount         float64      `json:"amount"`
+	Currency       string       `gorm:"type:VARCHAR(3)" json:"currency"`
+	Reason         string       `json:"reason"`
+	Status         RefundStatus `gorm:"type:VARCHAR(20);default:'pending'" json:"status"`
+	TranRef        string       `json:"tran_ref"`   // original payment transaction
+	RefundRef      string       `json:"refund_ref"` // refund transaction returned by the gateway
+	GatewayMessage string       `json:"gateway_message"`
+	CreatedBy      string       `json:"created_by"` // admin who issued the refund
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// RefundItem is the part of a refund attributed to a single order line.
+type RefundItem struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	RefundID    uint    `gorm:"index" json:"refund_id"`
+	OrderItemID uint    `gorm:"index" json:"order_item_id"`
+	Quantity    int     `json:"quantity"`
+	Amount      float64 `json:"amount"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ShippingRule prices shipping for a destination and weight band.
+// Country and City match models.Address case-insensitively; empty means any.
+// A rule covers weights in (MinWeight, MaxWeight]; MaxWeight 0 has no upper bound,
+// so a rule with both at 0 is a flat rate for its destination.
+type ShippingRule struct {
+	ID        uint    `gorm:"primaryKey" json:"id"`
+	Name      string  `json:"name"`
+	Country   string  `gorm:"index" json:"country"`
+	City      string  `json:"city"`
+	MinWeight float64 `json:"min_weight"`
+	MaxWeight float64 `json:"max_weight"`
+	Cost      float64 `json:"cost"`
+	// Weight above MinWeight is charged StepCost per started StepWeight (e.g. 30 per 30 kg)
+	StepWeight float64 `json:"step_weight"`
+	StepCost   float64 `json:"step_cost"`
+	// Subtotals at or above FreeOver ship free; 0 disables free shipping
+	FreeOver  float64   `json:"free_over"`
+	Priority  int       `gorm:"default:0" json:"priority"` // higher wins among equally specific rules
+	Active    bool      `gorm:"default:true" json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type StockMovementReason string
+
+const (
+	StockMovementSale       StockMovementReason = "sale"       // Units sold when an order is placed
+	StockMovementRestock    StockMovementReason = "restock"    // Units back from a cancelled or deleted order
+	StockMovementImport     StockMovementReason = "import"     // Stock set by an Excel import
+	StockMovementAdjustment StockMovementReason = "adjustment" // Stock edited by hand by an admin
+	StockMovementReturn     StockMovementReason = "return"     // Returned units put back on sale
+)
+
+// StockMovement is one change to a product's stock. Rows are only ever appended,
+// so the history explains how Product.Stock reached its current value.
+type StockMovement struct {
+	ID          uint                `gorm:"primaryKey" json:"id"`
+	ProductID   uint                `gorm:"index;not null" json:"product_id"`
+	Delta       int                 `json:"delta"`
+	StockAfter  int                 `json:"stock_after"`
+	Reason      StockMovementReason `gorm:"type:VARCHAR(20);index" json:"reason"`
+	ReferenceID string              `gorm:"index" json:"reference_id"` // order ID, import file name, ...
+	Actor       string              `json:"actor"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+// RecordStockMovement appends a movement for a stock change. Zero deltas are skipped.
+func RecordStockMovement(db *gorm.DB, productID uint, delta, stockAfter int, reason StockMovementReason, referenceID, actor string) error {
+	if delta == 0 {
+		return nil
+	}
+	return db.Create(&StockMovement{
+		ProductID:   productID,
+		Delta:       delta,
+		StockAfter:  stockAfter,
+		Reason:      reason,
+		ReferenceID: referenceID,
+		Actor:       actor,
+	}).Error
+}
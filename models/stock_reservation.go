@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type StockReservationStatus string
+
+const (
+	StockReservationActive    StockReservationStatus = "active"    // Held until ExpiresAt, or longer while its payment is pending
+	StockReservationConverted StockReservationStatus = "converted" // Turned into a sale when the order was placed
+	StockReservationReleased  StockReservationStatus = "released"  // Expired, payment failed or superseded by a new checkout
+)
+
+// StockReservation holds units of a product for a cart while its payment is in flight.
+// Active reservations count against Product.Stock for everyone else until they
+// expire, and past ExpiresAt while their payment session is still pending.
+type StockReservation struct {
+	ID               uint                   `gorm:"primaryKey" json:"id"`
+	CartID           uint                   `gorm:"index;not null" json:"cart_id"`
+	PaymentSessionID uint                   `gorm:"index" json:"payment_session_id"`
+	ProductID        uint                   `gorm:"index;not null" json:"product_id"`
+	Quantity         int                    `json:"quantity"`
+	Status           StockReservationStatus `gorm:"type:VARCHAR(20);default:'active';index" json:"status"`
+	ExpiresAt        time.Time              `gorm:"index" json:"expires_at"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+}
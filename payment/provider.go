@@ -0,0 +1,98 @@
+package payment
+
+import "net/http"
+
+// Status is a gateway-neutral payment or transaction state
+type Status string
+
+const (
+	StatusPending   Status = "pending"   // Customer has not completed payment yet
+	StatusApproved  Status = "approved"  // Payment authorised or captured
+	StatusHeld      Status = "held"      // Gateway is reviewing; a final status follows
+	StatusCancelled Status = "cancelled" // Customer cancelled on the payment page
+	StatusDeclined  Status = "declined"  // Declined by the bank or gateway
+	StatusExpired   Status = "expired"   // Payment page expired unused
+)
+
+// Address is the customer's billing address sent to the gateway
+type Address struct {
+	Line1    string
+	Line2    string
+	City     string
+	Region   string
+	Country  string
+	Postcode string
+}
+
+// Customer identifies the payer
+type Customer struct {
+	Name    string
+	Email   string
+	Phone   string
+	Address Address
+}
+
+// CreateRequest opens a hosted payment page for a server-priced amount
+type CreateRequest struct {
+	Reference   string // unique per payment attempt, echoed back by webhooks
+	Amount      float64
+	Currency    string
+	Description string
+	Customer    Customer
+}
+
+// CreateResult is where to send the customer and the gateway's reference for the payment
+type CreateResult struct {
+	PaymentURL  string
+	ProviderRef string
+}
+
+// Notification is a verified webhook delivery
+type Notification struct {
+	Reference string // our Reference from CreateRequest
+	TranRef   string // gateway transaction, unique per delivery outcome
+	Status    Status
+	Amount    string
+	Currency  string
+	Message   string
+}
+
+// StatusResult is the gateway's current view of a payment
+type StatusResult struct {
+	Status   Status
+	TranRef  string
+	Amount   string
+	Currency string
+	Message  string
+}
+
+// RefundRequest returns part or all of a captured transaction
+type RefundRequest struct {
+	TranRef     string
+	Reference   string
+	Amount      float64
+	Currency    string
+	Description string
+}
+
+// RefundResult is the gateway's answer to a refund; Approved is false when it was rejected
+type RefundResult struct {
+	Approved  bool
+	RefundRef string
+	Message   string
+}
+
+// PaymentProvider is a card gateway. Checkout, webhooks, reconciliation and refunds
+// talk to the gateway only through this interface.
+type PaymentProvider interface {
+	// Name identifies the provider on stored payment sessions
+	Name() string
+	// CreatePayment opens a payment for the given amount
+	CreatePayment(req CreateRequest) (*CreateResult, error)
+	// VerifyWebhook authenticates a webhook request and parses it
+	VerifyWebhook(r *http.Request) (*Notification, error)
+	// QueryStatus asks the gateway for the state of a payment by its provider ref
+	QueryStatus(providerRef string) (*StatusResult, error)
+	// Refund returns money from a captured transaction
+	Refund(req RefundRequest) (*RefundResult, error)
+}
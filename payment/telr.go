@@ -0,0 +1,374 @@
+package payment
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTelrRemoteURL = "https://secure.telr.com/gateway/remote.xml"
+
+// Telr order status codes returned by the "check" method
+const (
+	telrOrderPending    = 1
+	telrOrderAuthorised = 2
+	telrOrderPaid       = 3
+	telrOrderExpired    = -1
+	telrOrderCancelled  = -2
+	telrOrderDeclined   = -3
+)
+
+// telrSignatureFields are hashed, in order, to build the webhook tran_check
+var telrSignatureFields = []string{
+	"tran_store", "tran_type", "tran_class", "tran_test", "tran_ref",
+	"tran_prevref", "tran_firstref", "tran_order", "tran_currency",
+	"tran_amount", "tran_cartid", "tran_desc", "tran_status",
+	"tran_authcode", "tran_authmessage",
+}
+
+// TelrConfig holds the Telr credentials and endpoints
+type TelrConfig struct {
+	StoreID       int
+	AuthKey       string
+	APIURL        string // order API (create / check)
+	RemoteAuthKey string
+	RemoteAPIURL  string // remote API (refunds)
+	WebhookSecret string
+	TestMode      bool // sandbox/dev: test transactions and no webhook signature check
+	SuccessURL    string
+	FailureURL    string
+	CancelURL     string
+}
+
+// TelrConfigFromEnv reads the Telr configuration from environment variables
+func TelrConfigFromEnv() TelrConfig {
+	storeID, _ := strconv.Atoi(os.Getenv("TELR_STORE_ID_PROD"))
+	mode := strings.ToLower(os.Getenv("TELR_MODE"))
+
+	cfg := TelrConfig{
+		StoreID:       storeID,
+		AuthKey:       os.Getenv("TELR_AUTH_KEY_PROD"),
+		APIURL:        os.Getenv("TELR_API_URL_PROD"),
+		RemoteAuthKey: os.Getenv("TELR_REMOTE_AUTH_KEY"),
+		RemoteAPIURL:  os.Getenv("TELR_REMOTE_API_URL"),
+		WebhookSecret: os.Getenv("TELR_WEBHOOK_SECRET"),
+		TestMode:      mode == "sandbox" || mode == "dev",
+		SuccessURL:    os.Getenv("TELR_SUCCESS_URL"),
+		FailureURL:    os.Getenv("TELR_FAILURE_URL"),
+		CancelURL:     os.Getenv("TELR_CANCEL_URL"),
+	}
+	if cfg.RemoteAPIURL == "" {
+		cfg.RemoteAPIURL = defaultTelrRemoteURL
+	}
+	return cfg
+}
+
+// TelrProvider implements PaymentProvider for the Telr hosted payment page
+type TelrProvider struct {
+	cfg    TelrConfig
+	client *http.Client
+}
+
+// NewTelrProvider builds a Telr provider. A nil client gets a default with a timeout.
+func NewTelrProvider(cfg TelrConfig, client *http.Client) *TelrProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &TelrProvider{cfg: cfg, client: client}
+}
+
+func (p *TelrProvider) Name() string {
+	return "telr"
+}
+
+// testFlag is Telr's numeric test-mode flag
+func (p *TelrProvider) testFlag() int {
+	if p.cfg.TestMode {
+		return 1 // use test mode even on live endpoint
+	}
+	return 0
+}
+
+// TelrPaymentResponse represents Telr response
+type TelrPaymentResponse struct {
+	Order struct {
+		Ref string `json:"ref"`
+		URL string `json:"url"`
+	} `json:"order"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// CreatePayment sends a "create" request to Telr and returns the payment URL & order reference
+func (p *TelrProvider) CreatePayment(req CreateRequest) (*CreateResult, error) {
+	if p.cfg.StoreID == 0 || p.cfg.AuthKey == "" || p.cfg.APIURL == "" {
+		return nil, fmt.Errorf("telr configuration missing")
+	}
+
+	payload := map[string]interface{}{
+		"method":  "create",
+		"store":   p.cfg.StoreID,
+		"authkey": p.cfg.AuthKey,
+		"order": map[string]interface{}{
+			"cartid":      req.Reference,
+			"test":        p.testFlag(),
+			"amount":      fmt.Sprintf("%.2f", req.Amount),
+			"currency":    req.Currency,
+			"description": req.Description,
+		},
+		"customer": map[string]interface{}{
+			"name":  req.Customer.Name,
+			"email": req.Customer.Email,
+			"phone": req.Customer.Phone,
+			"address": map[string]string{
+				"line1":    req.Customer.Address.Line1,
+				"line2":    req.Customer.Address.Line2,
+				"city":     req.Customer.Address.City,
+				"region":   req.Customer.Address.Region,
+				"country":  req.Customer.Address.Country,
+				"postcode": req.Customer.Address.Postcode,
+			},
+		},
+		"return": map[string]string{
+			"authorised": p.cfg.SuccessURL,
+			"declined":   p.cfg.FailureURL,
+			"cancelled":  p.cfg.CancelURL,
+		},
+	}
+
+	var telrResp TelrPaymentResponse
+	if err := p.postJSON(payload, &telrResp); err != nil {
+		return nil, err
+	}
+
+	if telrResp.Error != nil {
+		return nil, fmt.Errorf("telr error: %s", telrResp.Error.Message)
+	}
+
+	if telrResp.Order.URL == "" {
+		return nil, fmt.Errorf("telr returned empty payment URL")
+	}
+
+	return &CreateResult{PaymentURL: telrResp.Order.URL, ProviderRef: telrResp.Order.Ref}, nil
+}
+
+// VerifyWebhook checks the Telr tran_check signature (skipped in sandbox/dev mode)
+// and parses the transaction notification.
+func (p *TelrProvider) VerifyWebhook(r *http.Request) (*Notification, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("failed to parse form: %v", err)
+	}
+
+	if p.cfg.TestMode {
+		fmt.Println("Sandbox/dev mode: skipping Telr webhook signature verification")
+	} else {
+		if p.cfg.WebhookSecret == "" {
+			return nil, errors.New("TELR_WEBHOOK_SECRET is not set")
+		}
+
+		providedCheck := r.PostFormValue("tran_check")
+		if providedCheck == "" {
+			return nil, errors.New("missing tran_check signature")
+		}
+
+		parts := []string{p.cfg.WebhookSecret}
+		for _, f := range telrSignatureFields {
+			parts = append(parts, strings.TrimSpace(r.PostFormValue(f)))
+		}
+
+		h := sha1.New()
+		h.Write([]byte(strings.Join(parts, ":")))
+		calculated := hex.EncodeToString(h.Sum(nil))
+
+		if !strings.EqualFold(calculated, providedCheck) {
+			return nil, errors.New("invalid webhook signature")
+		}
+	}
+
+	return &Notification{
+		Reference: r.PostFormValue("tran_cartid"),
+		TranRef:   r.PostFormValue("tran_ref"),
+		Status:    telrTransactionStatus(r.PostFormValue("tran_status")),
+		Amount:    r.PostFormValue("tran_amount"),
+		Currency:  r.PostFormValue("tran_currency"),
+		Message:   r.PostFormValue("tran_authmessage"),
+	}, nil
+}
+
+// telrTransactionStatus maps a Telr tran_status letter
+func telrTransactionStatus(code string) Status {
+	switch code {
+	case "A":
+		return StatusApproved
+	case "H":
+		return StatusHeld
+	case "C":
+		return StatusCancelled
+	default: // "D" declined, "E" error
+		return StatusDeclined
+	}
+}
+
+// TelrCheckResponse represents Telr response to the "check" method
+type TelrCheckResponse struct {
+	Order struct {
+		Ref      string      `json:"ref"`
+		CartID   string      `json:"cartid"`
+		Amount   json.Number `json:"amount"`
+		Currency string      `json:"currency"`
+		Status   struct {
+			Code int    `json:"code"`
+			Text string `json:"text"`
+		} `json:"status"`
+		Transaction struct {
+			Ref     string `json:"ref"`
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"transaction"`
+	} `json:"order"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// QueryStatus runs the Telr "check" method for an order reference
+func (p *TelrProvider) QueryStatus(providerRef string) (*StatusResult, error) {
+	if p.cfg.StoreID == 0 || p.cfg.AuthKey == "" || p.cfg.APIURL == "" {
+		return nil, fmt.Errorf("telr configuration missing")
+	}
+
+	payload := map[string]interface{}{
+		"method":  "check",
+		"store":   p.cfg.StoreID,
+		"authkey": p.cfg.AuthKey,
+		"order": map[string]string{
+			"ref": providerRef,
+		},
+	}
+
+	var telrResp TelrCheckResponse
+	if err := p.postJSON(payload, &telrResp); err != nil {
+		return nil, err
+	}
+	if telrResp.Error != nil {
+		return nil, fmt.Errorf("telr error: %s", telrResp.Error.Message)
+	}
+
+	result := &StatusResult{
+		TranRef:  telrResp.Order.Transaction.Ref,
+		Amount:   telrResp.Order.Amount.String(),
+		Currency: telrResp.Order.Currency,
+		Message:  telrResp.Order.Status.Text,
+	}
+	switch telrResp.Order.Status.Code {
+	case telrOrderAuthorised, telrOrderPaid:
+		result.Status = StatusApproved
+	case telrOrderExpired:
+		result.Status = StatusExpired
+	case telrOrderCancelled:
+		result.Status = StatusCancelled
+	case telrOrderDeclined:
+		result.Status = StatusDeclined
+	case telrOrderPending:
+		result.Status = StatusPending
+	default:
+		return nil, fmt.Errorf("unknown telr order status %d", telrResp.Order.Status.Code)
+	}
+	return result, nil
+}
+
+// TelrRemoteResponse represents the Telr remote API (remote.xml) response
+type TelrRemoteResponse struct {
+	XMLName xml.Name `xml:"remote"`
+	Auth    struct {
+		Status  string `xml:"status"` // "A" = authorised
+		Code    string `xml:"code"`
+		Message string `xml:"message"`
+		TranRef string `xml:"tranref"`
+	} `xml:"auth"`
+}
+
+// Refund refunds part or all of an original Telr transaction through the remote API
+func (p *TelrProvider) Refund(req RefundRequest) (*RefundResult, error) {
+	if p.cfg.StoreID == 0 || p.cfg.RemoteAuthKey == "" {
+		return nil, fmt.Errorf("telr remote API configuration missing")
+	}
+
+	form := url.Values{}
+	form.Set("ivp_store", strconv.Itoa(p.cfg.StoreID))
+	form.Set("ivp_authkey", p.cfg.RemoteAuthKey)
+	form.Set("ivp_trantype", "refund")
+	form.Set("ivp_tranclass", "ecom")
+	form.Set("ivp_desc", req.Description)
+	form.Set("ivp_cart", req.Reference)
+	form.Set("ivp_currency", req.Currency)
+	form.Set("ivp_amount", fmt.Sprintf("%.2f", req.Amount))
+	form.Set("ivp_test", strconv.Itoa(p.testFlag()))
+	form.Set("tran_ref", req.TranRef)
+
+	httpReq, _ := http.NewRequest("POST", p.cfg.RemoteAPIURL, strings.NewReader(form.Encode()))
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := p.do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var remoteResp TelrRemoteResponse
+	if err := xml.Unmarshal(body, &remoteResp); err != nil {
+		return nil, fmt.Errorf("failed to parse Telr response: %v", err)
+	}
+	return &RefundResult{
+		Approved:  remoteResp.Auth.Status == "A",
+		RefundRef: remoteResp.Auth.TranRef,
+		Message:   remoteResp.Auth.Message,
+	}, nil
+}
+
+// postJSON posts a payload to the Telr order API and decodes the JSON response into out
+func (p *TelrProvider) postJSON(payload interface{}, out interface{}) error {
+	jsonData, _ := json.Marshal(payload)
+
+	req, _ := http.NewRequest("POST", p.cfg.APIURL, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	body, err := p.do(req)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse Telr response: %v", err)
+	}
+	return nil
+}
+
+// do sends a request and returns the body of a 200 response
+func (p *TelrProvider) do(req *http.Request) ([]byte, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Telr: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("telr API error (%d): %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
@@ -0,0 +1,196 @@
+package payment
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeTelr is an httptest Telr server: the order API answers with orderReply and
+// the remote API with remoteReply, and the last request of each is kept.
+type fakeTelr struct {
+	server      *httptest.Server
+	orderReply  string
+	remoteReply string
+	lastOrder   map[string]interface{}
+	lastRemote  url.Values
+}
+
+func newFakeTelr(t *testing.T) *fakeTelr {
+	f := &fakeTelr{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/order.json", func(w http.ResponseWriter, r *http.Request) {
+		f.lastOrder = nil
+		if err := json.NewDecoder(r.Body).Decode(&f.lastOrder); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(f.orderReply))
+	})
+	mux.HandleFunc("/remote.xml", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.lastRemote = r.PostForm
+		w.Write([]byte(f.remoteReply))
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeTelr) provider(cfg TelrConfig) *TelrProvider {
+	cfg.StoreID = 1234
+	cfg.AuthKey = "order-key"
+	cfg.RemoteAuthKey = "remote-key"
+	cfg.APIURL = f.server.URL + "/order.json"
+	cfg.RemoteAPIURL = f.server.URL + "/remote.xml"
+	return NewTelrProvider(cfg, f.server.Client())
+}
+
+func TestTelrCreatePayment(t *testing.T) {
+	telr := newFakeTelr(t)
+	telr.orderReply = `{"order":{"ref":"OR123","url":"https://secure.telr.com/gateway/process.html?o=OR123"}}`
+	p := telr.provider(TelrConfig{TestMode: true})
+
+	result, err := p.CreatePayment(CreateRequest{Reference: "7-42", Amount: 130, Currency: "AED", Description: "Order 7-42"})
+	if err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+	if result.ProviderRef != "OR123" || !strings.Contains(result.PaymentURL, "OR123") {
+		t.Errorf("got %+v", result)
+	}
+
+	order, _ := telr.lastOrder["order"].(map[string]interface{})
+	if telr.lastOrder["method"] != "create" || order["cartid"] != "7-42" || order["amount"] != "130.00" || order["test"] != float64(1) {
+		t.Errorf("Telr got %v", telr.lastOrder)
+	}
+}
+
+func TestTelrCreatePaymentError(t *testing.T) {
+	telr := newFakeTelr(t)
+	telr.orderReply = `{"error":{"code":"E01","message":"Invalid store"}}`
+	p := telr.provider(TelrConfig{})
+
+	if _, err := p.CreatePayment(CreateRequest{Reference: "7-42", Amount: 130, Currency: "AED"}); err == nil || !strings.Contains(err.Error(), "Invalid store") {
+		t.Errorf("got error %v, want the Telr error", err)
+	}
+}
+
+func TestTelrQueryStatus(t *testing.T) {
+	tests := []struct {
+		code int
+		want Status
+	}{
+		{telrOrderPending, StatusPending},
+		{telrOrderAuthorised, StatusApproved},
+		{telrOrderPaid, StatusApproved},
+		{telrOrderExpired, StatusExpired},
+		{telrOrderCancelled, StatusCancelled},
+		{telrOrderDeclined, StatusDeclined},
+	}
+	telr := newFakeTelr(t)
+	p := telr.provider(TelrConfig{})
+
+	for _, tt := range tests {
+		reply, _ := json.Marshal(map[string]interface{}{"order": map[string]interface{}{
+			"ref":         "OR123",
+			"amount":      "130.00",
+			"currency":    "AED",
+			"status":      map[string]interface{}{"code": tt.code, "text": "status text"},
+			"transaction": map[string]interface{}{"ref": "T100"},
+		}})
+		telr.orderReply = string(reply)
+
+		result, err := p.QueryStatus("OR123")
+		if err != nil {
+			t.Fatalf("QueryStatus(code %d): %v", tt.code, err)
+		}
+		if result.Status != tt.want || result.TranRef != "T100" || result.Amount != "130.00" || result.Currency != "AED" {
+			t.Errorf("code %d: got %+v, want status %s", tt.code, result, tt.want)
+		}
+	}
+
+	order, _ := telr.lastOrder["order"].(map[string]interface{})
+	if telr.lastOrder["method"] != "check" || order["ref"] != "OR123" {
+		t.Errorf("Telr got %v", telr.lastOrder)
+	}
+}
+
+func TestTelrRefund(t *testing.T) {
+	telr := newFakeTelr(t)
+	p := telr.provider(TelrConfig{})
+
+	telr.remoteReply = `<remote><auth><status>A</status><code>1</code><message>Accepted</message><tranref>RF9</tranref></auth></remote>`
+	result, err := p.Refund(RefundRequest{TranRef: "T100", Reference: "7-42", Amount: 50, Currency: "AED"})
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if !result.Approved || result.RefundRef != "RF9" {
+		t.Errorf("got %+v", result)
+	}
+	if telr.lastRemote.Get("ivp_trantype") != "refund" || telr.lastRemote.Get("tran_ref") != "T100" || telr.lastRemote.Get("ivp_amount") != "50.00" {
+		t.Errorf("Telr got %v", telr.lastRemote)
+	}
+
+	telr.remoteReply = `<remote><auth><status>D</status><message>Refund exceeds capture</message></auth></remote>`
+	result, err = p.Refund(RefundRequest{TranRef: "T100", Reference: "7-42", Amount: 500, Currency: "AED"})
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if result.Approved || result.Message != "Refund exceeds capture" {
+		t.Errorf("got %+v, want a declined refund", result)
+	}
+}
+
+// signedWebhook builds a Telr webhook request signed with secret
+func signedWebhook(secret string, form url.Values) *http.Request {
+	parts := []string{secret}
+	for _, f := range telrSignatureFields {
+		parts = append(parts, form.Get(f))
+	}
+	sum := sha1.Sum([]byte(strings.Join(parts, ":")))
+	form.Set("tran_check", hex.EncodeToString(sum[:]))
+
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestTelrVerifyWebhook(t *testing.T) {
+	p := NewTelrProvider(TelrConfig{WebhookSecret: "s3cret"}, nil)
+	form := func() url.Values {
+		return url.Values{
+			"tran_store":       {"1234"},
+			"tran_ref":         {"T100"},
+			"tran_cartid":      {"7-42"},
+			"tran_amount":      {"130.00"},
+			"tran_currency":    {"AED"},
+			"tran_status":      {"A"},
+			"tran_authmessage": {"Authorised"},
+		}
+	}
+
+	n, err := p.VerifyWebhook(signedWebhook("s3cret", form()))
+	if err != nil {
+		t.Fatalf("VerifyWebhook: %v", err)
+	}
+	want := Notification{Reference: "7-42", TranRef: "T100", Status: StatusApproved, Amount: "130.00", Currency: "AED", Message: "Authorised"}
+	if *n != want {
+		t.Errorf("got %+v, want %+v", *n, want)
+	}
+
+	if _, err := p.VerifyWebhook(signedWebhook("wrong", form())); err == nil {
+		t.Error("accepted a webhook signed with the wrong secret")
+	}
+
+	tampered := signedWebhook("s3cret", form())
+	tampered.ParseForm()
+	tampered.PostForm.Set("tran_amount", "1.00")
+	if _, err := p.VerifyWebhook(tampered); err == nil {
+		t.Error("accepted a webhook with a tampered amount")
+	}
+}
@@ -4,21 +4,32 @@ import (
 	"github.com/gin-gonic/gin"
 	adminController "github.com/junaidrashid-git/ecommerce-api/controllers/admin"
 	cartControllers "github.com/junaidrashid-git/ecommerce-api/controllers/cart"
+	orderControllers "github.com/junaidrashid-git/ecommerce-api/controllers/order"
 	productcontroller "github.com/junaidrashid-git/ecommerce-api/controllers/product"
 	qrcontroller "github.com/junaidrashid-git/ecommerce-api/controllers/qr"
+	telrControllers "github.com/junaidrashid-git/ecommerce-api/controllers/telr"
 	userControllers "github.com/junaidrashid-git/ecommerce-api/controllers/user"
 	"github.com/junaidrashid-git/ecommerce-api/middleware"
+	"github.com/junaidrashid-git/ecommerce-api/payment"
 	"gorm.io/gorm"
 )
 
-// SetupAdminRoutes registers all “/admin/*” endpoints. Requires API‐Key middleware.
-func SetupAdminRoutes(r *gin.Engine, db *gorm.DB) {
+// SetupAdminRoutes registers all “/admin/*” endpoints. Requires an admin or superadmin JWT
+// from a still-approved admin, or the legacy API key when ALLOW_LEGACY_API_KEY is on;
+// admin approval and the audit log are superadmin-only.
+func SetupAdminRoutes(r *gin.Engine, db *gorm.DB, provider payment.PaymentProvider) {
 
 	uploadDir := "/var/www/trendybacked/uploads/qrfiles"
 	publicBaseURL := "https://server.trendy-c.com/uploads"
 
 	adminGroup := r.Group("/admin")
-	adminGroup.Use(middleware.ValidateAPIKey)
+	adminGroup.Use(
+		middleware.ValidateAPIKey,
+		middleware.ValidateToken,
+		middleware.RequireRole(middleware.RoleAdmin, middleware.RoleSuperAdmin),
+		middleware.RequireActiveAdmin(db),
+		middleware.AuditAdminActions(db),
+	)
 	{
 		// ─────────── Admin & User Management ───────────
 		adminGroup.GET("/admins", adminController.GetAllAdmins(db))
@@ -32,13 +43,25 @@ func SetupAdminRoutes(r *gin.Engine, db *gorm.DB) {
 		{
 			productAdmin.POST("", productcontroller.CreateProduct(db))
 			productAdmin.PUT("/:id", productcontroller.UpdateProduct(db))
-			productAdmin.GET("", productcontroller.GetProducts(db))
+			productAdmin.GET("", productcontroller.GetAdminProducts(db))
 			productAdmin.DELETE("/:id", productcontroller.DeleteProduct(db))
 			productAdmin.POST("/import-excel", productcontroller.ImportProductsFromExcel(db))
 			productAdmin.GET("/export-excel", productcontroller.ExportProductsToExcel(db))
+			productAdmin.GET("/:id/stock-movements", productcontroller.GetStockMovements(db))
+			productAdmin.GET("/low-stock", productcontroller.GetLowStockProducts(db))
+			productAdmin.GET("/low-stock/export-excel", productcontroller.ExportRestockListToExcel(db))
 
 		}
 
+		// ─────────── Scheduled Sales ───────────
+		scheduleAdmin := adminGroup.Group("/price-schedules")
+		{
+			scheduleAdmin.GET("", productcontroller.GetPriceSchedules(db))
+			scheduleAdmin.POST("", productcontroller.CreatePriceSchedule(db))
+			scheduleAdmin.PUT("/:id", productcontroller.UpdatePriceSchedule(db))
+			scheduleAdmin.DELETE("/:id", productcontroller.DeletePriceSchedule(db))
+		}
+
 		// ─────────── Category Management ───────────
 		categoryAdmin := adminGroup.Group("/categories")
 		{
@@ -50,12 +73,16 @@ func SetupAdminRoutes(r *gin.Engine, db *gorm.DB) {
 
 		// ─────────── Admin Approval Workflow ───────────
 		adminMgmt := adminGroup.Group("/admin-management")
+		adminMgmt.Use(middleware.RequireRole(middleware.RoleSuperAdmin))
 		{
 			adminMgmt.GET("/pending", adminController.ListPendingAdmins(db))
 			adminMgmt.POST("/approve", adminController.ApproveAdmin(db))
 			adminMgmt.POST("/reject", adminController.RejectAdmin(db))
 		}
 
+		// ─────────── Audit Log ───────────
+		adminGroup.GET("/audit-log", middleware.RequireRole(middleware.RoleSuperAdmin), adminController.GetAdminActions(db))
+
 		bannerMgmt := adminGroup.Group("/banner")
 		{
 			bannerMgmt.POST("/upload", adminController.UploadBanner(db))
@@ -66,5 +93,38 @@ func SetupAdminRoutes(r *gin.Engine, db *gorm.DB) {
 		{
 			cartMgmt.GET("/:user_id", cartControllers.GetAdminUserCart(db))
 		}
+
+		// ─────────── Payment Sessions ───────────
+		paymentAdmin := adminGroup.Group("/payments")
+		{
+			paymentAdmin.GET("", telrControllers.ListPaymentSessions(db))
+			paymentAdmin.GET("/:id", telrControllers.GetPaymentSession(db))
+		}
+
+		// ─────────── Shipping Rules ───────────
+		shippingAdmin := adminGroup.Group("/shipping-rules")
+		{
+			shippingAdmin.GET("", orderControllers.GetShippingRules(db))
+			shippingAdmin.POST("", orderControllers.CreateShippingRule(db))
+			shippingAdmin.PUT("/:id", orderControllers.UpdateShippingRule(db))
+			shippingAdmin.DELETE("/:id", orderControllers.DeleteShippingRule(db))
+		}
+
+		// ─────────── Coupons ───────────
+		couponAdmin := adminGroup.Group("/coupons")
+		{
+			couponAdmin.GET("", orderControllers.GetCoupons(db))
+			couponAdmin.POST("", orderControllers.CreateCoupon(db))
+			couponAdmin.PUT("/:id", orderControllers.UpdateCoupon(db))
+			couponAdmin.DELETE("/:id", orderControllers.DeleteCoupon(db))
+		}
+
+		// ─────────── Order Payments ───────────
+		orderAdmin := adminGroup.Group("/orders")
+		{
+			orderAdmin.POST("/:orderID/refunds", telrControllers.RefundOrderHandler(db, provider))
+			orderAdmin.GET("/:orderID/refunds", telrControllers.GetOrderRefunds(db))
+			orderAdmin.POST("/:orderID/cod-collected", orderControllers.MarkCODCollectedHandler(db))
+		}
 	}
 }
@@ -3,31 +3,54 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	orderControllers "github.com/junaidrashid-git/ecommerce-api/controllers/order"
+	"github.com/junaidrashid-git/ecommerce-api/middleware"
 	"gorm.io/gorm"
 )
 
 func SetupOrderRoutes(r *gin.Engine, db *gorm.DB) {
 	orders := r.Group("/orders")
 	{
-		// Create a new order
-		orders.POST("/place", orderControllers.PlaceOrderHandler(db))
-
-		// Fetch all orders (admin)
-		orders.GET("/", orderControllers.GetAllOrdersHandler(db))
-
-		// websocket endpoint for real-time order updates
-		orders.GET("/ws/orders", orderControllers.OrderWebSocketHandler)
-
-		// Fetch orders for a specific user
-		orders.GET("/user/:userID", orderControllers.GetUserOrdersHandler(db))
-
-		// Update order status (e.g., shipped, cancelled)
-		orders.PUT("/:orderID/status", orderControllers.UpdateOrderStatusHandler(db))
-
-		// Update payment status (e.g., paid, refunded)
-		orders.PUT("/:orderID/payment-status", orderControllers.UpdatePaymentStatusHandler(db))
-
-		// Delete an order
-		orders.DELETE("/:orderID", orderControllers.DeleteOrderHandler(db))
+		// websocket endpoint for real-time order updates (admin JWT, header or ?token=)
+		orders.GET("/ws/orders",
+			middleware.TokenFromQuery,
+			middleware.ValidateToken,
+			middleware.RequireRole(middleware.RoleAdmin, middleware.RoleSuperAdmin),
+			middleware.RequireActiveAdmin(db),
+			orderControllers.OrderWebSocketHandler,
+		)
+
+		// ──────────────── CUSTOMER ROUTES (JWT, own orders only) ────────────────
+		customer := orders.Group("")
+		customer.Use(middleware.ValidateToken)
+		{
+			// Fetch orders for a specific user (must match the token)
+			customer.GET("/user/:userID", orderControllers.GetUserOrdersHandler(db))
+		}
+
+		// ──────────────── ADMIN ROUTES (admin JWT, or legacy API key) ────────────────
+		admin := orders.Group("")
+		admin.Use(
+			middleware.ValidateAPIKey,
+			middleware.ValidateToken,
+			middleware.RequireRole(middleware.RoleAdmin, middleware.RoleSuperAdmin),
+			middleware.RequireActiveAdmin(db),
+			middleware.AuditAdminActions(db),
+		)
+		{
+			// Create a manual cash-on-delivery order from a cart
+			admin.POST("/place", orderControllers.PlaceOrderHandler(db))
+
+			// Fetch all orders
+			admin.GET("/", orderControllers.GetAllOrdersHandler(db))
+
+			// Update order status (e.g., shipped, cancelled)
+			admin.PUT("/:orderID/status", orderControllers.UpdateOrderStatusHandler(db))
+
+			// Update payment status (e.g., paid, failed); refunds go through /admin/orders/:orderID/refunds
+			admin.PUT("/:orderID/payment-status", orderControllers.UpdatePaymentStatusHandler(db))
+
+			// Delete an order
+			admin.DELETE("/:orderID", orderControllers.DeleteOrderHandler(db))
+		}
 	}
 }
@@ -2,24 +2,25 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/junaidrashid-git/ecommerce-api/payment"
 	"gorm.io/gorm"
 )
 
 // SetupRoutes is the single entry‐point that wires up Auth, User, and Admin route groups.
-func SetupRoutes(r *gin.Engine, db *gorm.DB) {
+func SetupRoutes(r *gin.Engine, db *gorm.DB, provider payment.PaymentProvider) {
 	// 1️⃣ Public Auth routes (no middleware)
 	SetupAuthRoutes(r, db)
 
 	// 2️⃣ User routes (JWT‐protected)
 	SetupUserRoutes(r, db)
 
-	// 3️⃣ Admin routes (API‐Key‐protected)
-	SetupAdminRoutes(r, db)
+	// 3️⃣ Admin routes (admin JWT, role-checked)
+	SetupAdminRoutes(r, db, provider)
 
 	// order routes
 	SetupOrderRoutes(r, db)
 
 	// telr payment routes
 
-	SetupTelrRoutes(r, db)
+	SetupTelrRoutes(r, db, provider)
 }
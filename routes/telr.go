@@ -2,21 +2,23 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	orderControllers "github.com/junaidrashid-git/ecommerce-api/controllers/order"
 	telrControllers "github.com/junaidrashid-git/ecommerce-api/controllers/telr"
 	"github.com/junaidrashid-git/ecommerce-api/middleware"
+	"github.com/junaidrashid-git/ecommerce-api/payment"
 	"gorm.io/gorm"
 )
 
-func SetupTelrRoutes(r *gin.Engine, db *gorm.DB) {
-	payment := r.Group("/payment")
+func SetupTelrRoutes(r *gin.Engine, db *gorm.DB, provider payment.PaymentProvider) {
+	paymentGroup := r.Group("/payment")
 	{
-		// Payment creation endpoint
-		payment.POST("/place", telrControllers.PaymentRequestHandler)
+		// Checkout endpoint: prices the user's cart server-side and opens a payment session
+		paymentGroup.POST("/place", middleware.ValidateToken, telrControllers.PaymentRequestHandler(db, provider))
 
-		// Webhook endpoint: middleware handles sandbox/prod verification
-		payment.POST("/webhook",
-			middleware.TelrWebhookAuth(),
-			telrControllers.TelrWebhookHandler(db),
-		)
+		// Cash on delivery checkout: creates the order straight away, payment pending
+		paymentGroup.POST("/cod", middleware.ValidateToken, orderControllers.PlaceCODOrderHandler(db))
+
+		// Webhook endpoint: the provider verifies the signature (skipped in sandbox/dev)
+		paymentGroup.POST("/webhook", telrControllers.TelrWebhookHandler(db, provider))
 	}
 }
@@ -3,6 +3,7 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	cartControllers "github.com/junaidrashid-git/ecommerce-api/controllers/cart"
+	orderControllers "github.com/junaidrashid-git/ecommerce-api/controllers/order"
 	productControllers "github.com/junaidrashid-git/ecommerce-api/controllers/product"
 	userControllers "github.com/junaidrashid-git/ecommerce-api/controllers/user"
 	"github.com/junaidrashid-git/ecommerce-api/middleware"
@@ -29,8 +30,10 @@ func SetupUserRoutes(r *gin.Engine, db *gorm.DB) {
 		publicGroup.GET("/products/:id", productControllers.GetProductByID(db))         // GET /public/products/:id
 		publicGroup.GET("/og/products/:id", productControllers.GetProductOGHandler(db)) // GET /og/public/products/:id
 		// Publicly accessible category routes
-		publicGroup.GET("/categories", productControllers.GetAllCategoriesWithProducts(db))
+		publicGroup.GET("/categories", productControllers.GetCategoryTree(db))
 		publicGroup.GET("/categories/:id", productControllers.GetCategoryByID(db))
+		// Shipping quote, priced by the same rules checkout uses
+		publicGroup.GET("/shipping/quote", orderControllers.ShippingQuoteHandler(db)) // GET /public/shipping/quote
 	}
 
 	// ──────────────── AUTHENTICATED USER ROUTES ────────────────
@@ -45,6 +48,9 @@ func SetupUserRoutes(r *gin.Engine, db *gorm.DB) {
 		cartGroup := userGroup.Group("/cart")
 		{
 			cartGroup.GET("/", cartControllers.GetUserCart(db))                  // GET /user/cart
+			cartGroup.GET("/summary", cartControllers.GetUserCartSummary(db))    // GET /user/cart/summary
+			cartGroup.POST("/coupon", cartControllers.ApplyCartCoupon(db))       // POST /user/cart/coupon
+			cartGroup.DELETE("/coupon", cartControllers.RemoveCartCoupon(db))    // DELETE /user/cart/coupon
 			cartGroup.POST("/", cartControllers.UpdateCartItem(db))              // POST /user/cart
 			cartGroup.DELETE("/:product_id", cartControllers.DeleteCartItem(db)) // DELETE /user/cart/:product_id
 			cartGroup.DELETE("/", cartControllers.ClearUserCart(db))             // DELETE /user/cart